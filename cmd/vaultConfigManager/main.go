@@ -1,16 +1,54 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/lein3000zzz/vault-config-manager/pkg/manager"
 	"go.uber.org/zap"
 )
 
+const usage = `usage: vaultConfigManager [command] [flags]
+
+commands:
+  run        start the config updater (default)
+  bootstrap  init, unseal and seed a fresh local Vault
+  expiry     report secrets that are expired or close to expiry (exits 1 if any are expired or mis-tagged)
+  overlay    show what an environment overlay (overlays/<env>/) changes compared with base/
+`
+
 func main() {
 	logger := initLogger()
 
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "run":
+		runUpdater(logger)
+	case "bootstrap":
+		runBootstrap(logger, args)
+	case "expiry":
+		runExpiryReport(logger, args)
+	case "overlay":
+		runOverlayDiff(logger, args)
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runUpdater(logger *zap.SugaredLogger) {
 	sm, err := manager.NewSecretManager(os.Getenv("VAULT_ADDRESS"), os.Getenv("VAULT_TOKEN"), manager.DefaultBasePathData, manager.DefaultBasePathMetaData, logger)
 	if err != nil {
 		logger.Fatal("Error creating secret manager", zap.Error(err))
@@ -19,6 +57,119 @@ func main() {
 	sm.StartConfigUpdater(manager.DefaultConfigUpdateInterval)
 }
 
+func runBootstrap(logger *zap.SugaredLogger, args []string) {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	shares := fs.Int("shares", 5, "number of unseal key shares")
+	threshold := fs.Int("threshold", 3, "number of shares required to unseal")
+	output := fs.String("out", "vault-init.json", "file to write unseal keys and root token to (created with 0600, never overwritten)")
+	seedFile := fs.String("seed", "", "JSON file with secrets to seed: {\"folder/\": {\"key\": \"value\"}}")
+	basePath := fs.String("base-path", manager.DefaultBasePathData, "base data path, its mount is enabled as kv")
+	baseMetaPath := fs.String("meta-path", manager.DefaultBasePathMetaData, "base metadata path")
+	_ = fs.Parse(args)
+
+	sm, err := manager.NewSecretManager(os.Getenv("VAULT_ADDRESS"), "", *basePath, *baseMetaPath, logger)
+	if err != nil {
+		logger.Fatal("Error creating secret manager", zap.Error(err))
+	}
+
+	result, err := sm.Bootstrap(context.Background(), manager.BootstrapOptions{
+		SecretShares:    *shares,
+		SecretThreshold: *threshold,
+		OutputFile:      *output,
+		SeedFile:        *seedFile,
+	})
+	if err != nil {
+		logger.Fatal("Error bootstrapping Vault", zap.Error(err))
+	}
+
+	logger.Infow("Vault bootstrapped", "output", *output, "mounted", result.Mounted, "seeded", result.SeededFolders)
+}
+
+func runExpiryReport(logger *zap.SugaredLogger, args []string) {
+	fs := flag.NewFlagSet("expiry", flag.ExitOnError)
+	warn := fs.Duration("warn", manager.DefaultExpiryWarning, "report secrets expiring within this duration")
+	basePath := fs.String("base-path", manager.DefaultBasePathData, "base data path")
+	baseMetaPath := fs.String("meta-path", manager.DefaultBasePathMetaData, "base metadata path")
+	_ = fs.Parse(args)
+
+	sm, err := manager.NewSecretManager(os.Getenv("VAULT_ADDRESS"), os.Getenv("VAULT_TOKEN"), *basePath, *baseMetaPath, logger)
+	if err != nil {
+		logger.Fatal("Error creating secret manager", zap.Error(err))
+	}
+
+	expiries, err := sm.CheckExpiry(context.Background(), *warn)
+	if err != nil {
+		logger.Fatal("Error checking secret expiry", zap.Error(err))
+	}
+
+	now := time.Now()
+	failed := false
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tSTATE\tEXPIRES AT\tEXPIRES IN\tUPDATED")
+	for _, expiry := range expiries {
+		if expiry.State == manager.ExpiryInvalid {
+			failed = true
+			fmt.Fprintf(tw, "%s\t%s\t%v\t\t\n", expiry.Folder, expiry.State, expiry.Err)
+			continue
+		}
+		if expiry.State == manager.ExpiryExpired {
+			failed = true
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", expiry.Folder, expiry.State,
+			expiry.ExpiresAt.Format(time.RFC3339), expiry.ExpiresIn(now).Round(time.Minute), expiry.UpdatedTime.Format(time.RFC3339))
+	}
+	_ = tw.Flush()
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runOverlayDiff(logger *zap.SugaredLogger, args []string) {
+	fs := flag.NewFlagSet("overlay", flag.ExitOnError)
+	mount := fs.String("mount", "kv", "kv mount with base/ and overlays/")
+	prefix := fs.String("prefix", "", "prefix inside the mount that holds base/ and overlays/")
+	env := fs.String("env", "", "overlay environment, defaults to $"+manager.EnvironmentEnvVar)
+	showValues := fs.Bool("show-values", false, "print secret values instead of hiding them")
+	_ = fs.Parse(args)
+
+	sm, err := manager.NewSecretManagerWithOptions(
+		manager.WithAddress(os.Getenv("VAULT_ADDRESS")),
+		manager.WithToken(os.Getenv("VAULT_TOKEN")),
+		manager.WithMount(*mount, *prefix),
+		manager.WithOverlays(*env),
+		manager.WithLogger(manager.NewZapLogger(logger)),
+	)
+	if err != nil {
+		logger.Fatal("Error creating secret manager", zap.Error(err))
+	}
+
+	changes, err := sm.OverlayDiff(context.Background())
+	if err != nil {
+		logger.Fatal("Error diffing overlay", zap.Error(err))
+	}
+
+	value := func(change manager.KeyChange, v any) string {
+		switch {
+		case v == nil && change.Kind == manager.ChangeAdded:
+			return "-"
+		case !*showValues:
+			return "<hidden>"
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "KEY\tCHANGE\tBASE\t%s\n", strings.ToUpper(sm.Environment()))
+	for _, change := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Key, change.Kind, value(change, change.Old), value(change, change.New))
+	}
+	_ = tw.Flush()
+}
+
 func initLogger() *zap.SugaredLogger {
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
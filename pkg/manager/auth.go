@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// DefaultAppRoleMount - маунт AppRole auth method по умолчанию
+const DefaultAppRoleMount = "approle"
+
+var (
+	ErrWrappingTokenUsed      = errors.New("wrapping token was already unwrapped or has expired")
+	ErrWrappingTokenTampered  = errors.New("wrapping token was created at an unexpected path")
+	ErrInvalidWrappedResponse = errors.New("wrapped response does not contain the expected credential")
+)
+
+// DefaultWrappedTokenCreationPaths - откуда может прийти обернутый токен, если в WithWrappedToken пути не переданы
+var DefaultWrappedTokenCreationPaths = []string{"auth/token/create", "auth/token/create-orphan", "auth/token/create/*"}
+
+type appRoleOption struct {
+	mount    string
+	roleID   string
+	secretID string
+	wrapped  bool // secretID - это wrapping token, сам secret_id достается из него
+}
+
+// WithWrappedToken - вместо токена передается wrapping token, в котором он лежит. При создании менеджера
+// токен один раз разворачивается через sys/wrapping/unwrap. creationPaths - пути, на которых обертка могла быть создана
+// (можно с * как в path.Match), по умолчанию DefaultWrappedTokenCreationPaths
+func WithWrappedToken(wrappingToken string, creationPaths ...string) Option {
+	return func(o *managerOptions) {
+		o.wrappingToken = wrappingToken
+		o.wrappingPaths = creationPaths
+	}
+}
+
+// WithAppRole - логин через AppRole при создании менеджера. Пустой mount - DefaultAppRoleMount
+func WithAppRole(mount, roleID, secretID string) Option {
+	return func(o *managerOptions) {
+		o.appRole = &appRoleOption{mount: mount, roleID: roleID, secretID: secretID}
+	}
+}
+
+// WithWrappedSecretID - логин через AppRole, где secret_id пришел обернутым. Обертка должна быть создана
+// на auth/<mount>/role/<role>/secret-id, иначе менеджер не создастся с ErrWrappingTokenTampered
+func WithWrappedSecretID(mount, roleID, wrappingToken string) Option {
+	return func(o *managerOptions) {
+		o.appRole = &appRoleOption{mount: mount, roleID: roleID, secretID: wrappingToken, wrapped: true}
+	}
+}
+
+// authenticate выставляет на клиент токен из обертки или из логина по AppRole, если об этом попросили опциями
+func (o *managerOptions) authenticate(ctx context.Context, client *vaultapi.Client) error {
+	switch {
+	case o.wrappingToken != "":
+		paths := o.wrappingPaths
+		if len(paths) == 0 {
+			paths = DefaultWrappedTokenCreationPaths
+		}
+
+		secret, err := unwrapResponse(ctx, client, o.logger, o.wrappingToken, paths)
+		if err != nil {
+			return err
+		}
+
+		if secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return fmt.Errorf("%w: no client token", ErrInvalidWrappedResponse)
+		}
+		client.SetToken(secret.Auth.ClientToken)
+
+	case o.appRole != nil:
+		token, err := o.appRole.login(ctx, client, o.logger)
+		if err != nil {
+			return err
+		}
+		client.SetToken(token)
+	}
+
+	return nil
+}
+
+func (a *appRoleOption) login(ctx context.Context, client *vaultapi.Client, logger Logger) (string, error) {
+	mount := a.mount
+	if mount == "" {
+		mount = DefaultAppRoleMount
+	}
+	mount = normalizeMount("auth/" + strings.TrimPrefix(strings.Trim(mount, "/"), "auth/"))
+
+	secretID := a.secretID
+	if a.wrapped {
+		secret, err := unwrapResponse(ctx, client, logger, a.secretID, []string{mount + "role/*/secret-id"})
+		if err != nil {
+			return "", err
+		}
+
+		secretID, _ = secret.Data["secret_id"].(string)
+		if secretID == "" {
+			return "", fmt.Errorf("%w: no secret_id", ErrInvalidWrappedResponse)
+		}
+	}
+
+	resp, err := client.Logical().WriteWithContext(ctx, mount+"login", map[string]any{
+		"role_id":   a.roleID,
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", ErrEmptyVaultResponse
+	}
+
+	logger.Info("Logged in with AppRole", "mount", mount, "token_ttl", resp.Auth.LeaseDuration)
+
+	return resp.Auth.ClientToken, nil
+}
+
+// unwrapResponse разворачивает wrapping token. Сначала обертка смотрится через sys/wrapping/lookup, который ее не тратит:
+// если она создана не там, где ожидалось, ее кто-то подменил, и разворачивать ее нельзя. Обертка одноразовая,
+// так что "не найдена" значит, что ее уже развернул кто-то другой или она истекла
+func unwrapResponse(ctx context.Context, client *vaultapi.Client, logger Logger, wrappingToken string, creationPaths []string) (*vaultapi.Secret, error) {
+	wrapClient, err := client.CloneWithHeaders()
+	if err != nil {
+		return nil, err
+	}
+	wrapClient.SetToken(wrappingToken)
+
+	info, err := wrapClient.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]any{"token": wrappingToken})
+	if err != nil {
+		return nil, wrappingError(logger, err)
+	}
+
+	if info == nil || info.Data == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	creationPath, _ := info.Data["creation_path"].(string)
+	if !matchCreationPath(creationPath, creationPaths) {
+		logger.Error("Wrapping token creation path mismatch, refusing to unwrap",
+			"creation_path", creationPath, "expected", creationPaths)
+		return nil, fmt.Errorf("%w: %q", ErrWrappingTokenTampered, creationPath)
+	}
+
+	secret, err := wrapClient.Logical().WriteWithContext(ctx, "sys/wrapping/unwrap", nil)
+	if err != nil {
+		return nil, wrappingError(logger, err)
+	}
+
+	if secret == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	logger.Info("Unwrapped response-wrapped credential", "creation_path", creationPath)
+
+	return secret, nil
+}
+
+func matchCreationPath(creationPath string, patterns []string) bool {
+	creationPath = strings.Trim(creationPath, "/")
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.Trim(pattern, "/"), creationPath); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrappingError отличает уже использованную обертку от остальных ошибок. Vault отвечает на нее 400,
+// а на unwrap с токеном, которого уже нет, еще и 403
+func wrappingError(logger Logger, err error) error {
+	var respErr *vaultapi.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+
+	used := respErr.StatusCode == http.StatusForbidden
+	for _, message := range respErr.Errors {
+		if strings.Contains(message, "wrapping token is not valid") {
+			used = true
+		}
+	}
+
+	if !used {
+		return err
+	}
+
+	logger.Warn("Wrapping token was already used or expired, the credential may have been intercepted")
+
+	return fmt.Errorf("%w: %w", ErrWrappingTokenUsed, err)
+}
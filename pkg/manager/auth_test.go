@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWrapping - sys/wrapping для fakeVault: обертки одноразовые, lookup их не тратит
+type fakeWrapping struct {
+	fv         *fakeVault
+	wrapped    map[string]fakeWrapped
+	created    int
+	unwraps    int
+	namespaces []string
+}
+
+type fakeWrapped struct {
+	creationPath string
+	response     map[string]any
+}
+
+func (fv *fakeVault) enableWrapping() *fakeWrapping {
+	wrapping := &fakeWrapping{fv: fv, wrapped: make(map[string]fakeWrapped)}
+
+	invalid := &fakeVaultError{code: http.StatusBadRequest, messages: []string{"wrapping token is not valid or does not exist"}}
+
+	fv.handle("sys/wrapping/lookup", func(r *fakeRequest) any {
+		fv.mu.Lock()
+		defer fv.mu.Unlock()
+
+		token, _ := r.body["token"].(string)
+		wrapped, ok := wrapping.wrapped[token]
+		if !ok {
+			return invalid
+		}
+		return map[string]any{"data": map[string]any{"creation_path": wrapped.creationPath, "creation_ttl": 300}}
+	})
+
+	fv.handle("sys/wrapping/unwrap", func(r *fakeRequest) any {
+		fv.mu.Lock()
+		defer fv.mu.Unlock()
+
+		wrapping.unwraps++
+		wrapping.namespaces = append(wrapping.namespaces, r.header.Get("X-Vault-Namespace"))
+		wrapped, ok := wrapping.wrapped[r.token]
+		if !ok {
+			return invalid
+		}
+		delete(wrapping.wrapped, r.token)
+		return wrapped.response
+	})
+
+	return wrapping
+}
+
+// wrap кладет ответ в обертку и отдает wrapping token
+func (w *fakeWrapping) wrap(creationPath string, response map[string]any) string {
+	w.fv.mu.Lock()
+	defer w.fv.mu.Unlock()
+
+	w.created++
+	token := fmt.Sprintf("hvs.wrap-%d", w.created)
+	w.wrapped[token] = fakeWrapped{creationPath: creationPath, response: response}
+
+	return token
+}
+
+// enableAppRole - auth/<mount>/login, который пускает только с заданными role_id и secret_id
+func (fv *fakeVault) enableAppRole(mount, roleID, secretID, clientToken string) {
+	fv.handle("auth/"+mount+"/login", func(r *fakeRequest) any {
+		if r.body["role_id"] != roleID || r.body["secret_id"] != secretID {
+			return &fakeVaultError{code: http.StatusBadRequest, messages: []string{"invalid role or secret ID"}}
+		}
+		return map[string]any{"auth": map[string]any{"client_token": clientToken, "lease_duration": 3600}}
+	})
+}
+
+func TestWithWrappedToken(t *testing.T) {
+	fv := newFakeVault(t)
+	wrapping := fv.enableWrapping()
+
+	wrappingToken := wrapping.wrap("auth/token/create", map[string]any{"auth": map[string]any{"client_token": "hvs.real"}})
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithWrappedToken(wrappingToken))
+	require.NoError(t, err)
+	assert.Equal(t, "hvs.real", sm.vaultClient.Token())
+
+	// повторно та же обертка уже не развернется
+	_, err = NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithWrappedToken(wrappingToken))
+	assert.True(t, errors.Is(err, ErrWrappingTokenUsed), "got error %v", err)
+	assert.Equal(t, 1, wrapping.unwraps)
+}
+
+func TestWrappedCredentialTampered(t *testing.T) {
+	wrappedCredentialTamperedTests := []struct {
+		name         string
+		creationPath string
+		opts         func(wrappingToken string) []Option
+	}{
+		{
+			name:         "token from kv",
+			creationPath: "kv/data/main/db",
+			opts: func(wrappingToken string) []Option {
+				return []Option{WithWrappedToken(wrappingToken)}
+			},
+		},
+		{
+			name:         "token from unexpected role",
+			creationPath: "auth/token/create/admin",
+			opts: func(wrappingToken string) []Option {
+				return []Option{WithWrappedToken(wrappingToken, "auth/token/create/app")}
+			},
+		},
+		{
+			name:         "secret id from another mount",
+			creationPath: "auth/other/role/app/secret-id",
+			opts: func(wrappingToken string) []Option {
+				return []Option{WithWrappedSecretID("", "role-id", wrappingToken)}
+			},
+		},
+	}
+
+	for _, test := range wrappedCredentialTamperedTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv := newFakeVault(t)
+			wrapping := fv.enableWrapping()
+			wrappingToken := wrapping.wrap(test.creationPath, map[string]any{
+				"auth": map[string]any{"client_token": "hvs.evil"},
+				"data": map[string]any{"secret_id": "evil"},
+			})
+
+			_, err := NewSecretManagerWithOptions(append(test.opts(wrappingToken), WithAddress(fv.server.URL))...)
+			assert.True(t, errors.Is(err, ErrWrappingTokenTampered), "got error %v", err)
+
+			// подмененную обертку не разворачиваем
+			assert.Equal(t, 0, wrapping.unwraps)
+		})
+	}
+}
+
+func TestWithWrappedSecretID(t *testing.T) {
+	fv := newFakeVault(t)
+	wrapping := fv.enableWrapping()
+	fv.enableAppRole("deploy", "role-id", "secret-id", "hvs.approle")
+
+	wrappingToken := wrapping.wrap("auth/deploy/role/app/secret-id", map[string]any{
+		"data": map[string]any{"secret_id": "secret-id", "secret_id_accessor": "accessor"},
+	})
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithWrappedSecretID("deploy", "role-id", wrappingToken))
+	require.NoError(t, err)
+	assert.Equal(t, "hvs.approle", sm.vaultClient.Token())
+
+	_, err = NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithWrappedSecretID("deploy", "role-id", wrappingToken))
+	assert.True(t, errors.Is(err, ErrWrappingTokenUsed), "got error %v", err)
+
+	// в обертке не secret_id
+	wrappingToken = wrapping.wrap("auth/deploy/role/app/secret-id", map[string]any{"data": map[string]any{"foo": "bar"}})
+	_, err = NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithWrappedSecretID("deploy", "role-id", wrappingToken))
+	assert.True(t, errors.Is(err, ErrInvalidWrappedResponse), "got error %v", err)
+}
+
+func TestWithAppRole(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableAppRole(DefaultAppRoleMount, "role-id", "secret-id", "hvs.approle")
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithAppRole("", "role-id", "secret-id"))
+	require.NoError(t, err)
+	assert.Equal(t, "hvs.approle", sm.vaultClient.Token())
+
+	_, err = NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithAppRole("", "role-id", "wrong"))
+	assert.Error(t, err)
+}
+
+func TestAuthOptionsConflict(t *testing.T) {
+	authOptionsConflictTests := []struct {
+		name string
+		opts []Option
+	}{
+		{"token and wrapped token", []Option{WithToken(testVaultToken), WithWrappedToken("hvs.wrap")}},
+		{"token and approle", []Option{WithToken(testVaultToken), WithAppRole("", "role", "secret")}},
+		{"wrapped token and wrapped secret id", []Option{WithWrappedToken("hvs.wrap"), WithWrappedSecretID("", "role", "hvs.wrap")}},
+	}
+
+	for _, test := range authOptionsConflictTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewSecretManagerWithOptions(test.opts...)
+			assert.True(t, errors.Is(err, ErrConflictingOptions), "got error %v", err)
+		})
+	}
+}
+
+func TestUnwrapKeepsNamespace(t *testing.T) {
+	fv := newFakeVault(t)
+	wrapping := fv.enableWrapping()
+	wrappingToken := wrapping.wrap("auth/token/create", map[string]any{"auth": map[string]any{"client_token": "hvs.real"}})
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithNamespace("team-a"), WithWrappedToken(wrappingToken))
+	require.NoError(t, err)
+
+	assert.Equal(t, "team-a", sm.vaultClient.Namespace())
+	assert.Equal(t, "hvs.real", sm.vaultClient.Token())
+	assert.Equal(t, []string{"team-a"}, wrapping.namespaces)
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	ErrAlreadyInitialized      = errors.New("vault is already initialized")
+	ErrInvalidBootstrapOptions = errors.New("invalid bootstrap options")
+	ErrKVVersionMismatch       = errors.New("existing kv mount has another version")
+)
+
+// BootstrapOptions - настройки Bootstrap
+type BootstrapOptions struct {
+	SecretShares    int
+	SecretThreshold int
+
+	// OutputFile - куда записать ключи и root token. Файл создается с правами 0600,
+	// существующий файл не перезаписывается, чтобы случайно не потерять ключи от другого vault'a
+	OutputFile string
+
+	// Seed - секреты для заливки: папка относительно basePath -> пары ключ-значение
+	Seed map[string]map[string]any
+
+	// SeedFile - JSON того же вида, что и Seed. Если заданы оба, значения из Seed побеждают
+	SeedFile string
+}
+
+// BootstrapResult - что получилось после Bootstrap. Keys и RootToken - это то, что лежит в OutputFile
+type BootstrapResult struct {
+	Keys       []string `json:"keys"`
+	KeysBase64 []string `json:"keys_base64"`
+	RootToken  string   `json:"root_token"`
+
+	Mounted       bool     `json:"-"`
+	SeededFolders []string `json:"-"`
+}
+
+func (opts BootstrapOptions) validate() error {
+	if opts.SecretShares < 1 {
+		return fmt.Errorf("%w: secret shares must be positive, got %d", ErrInvalidBootstrapOptions, opts.SecretShares)
+	}
+
+	if opts.SecretThreshold < 1 || opts.SecretThreshold > opts.SecretShares {
+		return fmt.Errorf("%w: threshold must be between 1 and %d, got %d",
+			ErrInvalidBootstrapOptions, opts.SecretShares, opts.SecretThreshold)
+	}
+
+	if opts.OutputFile == "" {
+		return fmt.Errorf("%w: output file is required", ErrInvalidBootstrapOptions)
+	}
+
+	return nil
+}
+
+// Bootstrap поднимает свежий vault для локального стенда: sys/init с заданными share/threshold, запись ключей и
+// root token'а в OutputFile, распечатывание, монтирование KV на маунт из basePath и, если надо, заливка секретов.
+// После Bootstrap менеджер ходит в vault с root token'ом. Только для dev-окружений
+func (sm *SecretManagerVault) Bootstrap(ctx context.Context, opts BootstrapOptions) (*BootstrapResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	seed, err := loadBootstrapSeed(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	initialized, err := sm.vaultClient.Sys().InitStatusWithContext(ctx)
+	if err != nil {
+		sm.logger.Error("Error getting init status", "error", err)
+		return nil, err
+	}
+
+	if initialized {
+		return nil, ErrAlreadyInitialized
+	}
+
+	// файл открываем до init: если записать ключи некуда, лучше не инициализировать vault вовсе
+	outputFile, err := os.OpenFile(opts.OutputFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating bootstrap output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	initResp, err := sm.vaultClient.Sys().InitWithContext(ctx, &vaultapi.InitRequest{
+		SecretShares:    opts.SecretShares,
+		SecretThreshold: opts.SecretThreshold,
+	})
+	if err != nil {
+		sm.logger.Error("Error initializing Vault", "error", err)
+		_ = os.Remove(opts.OutputFile)
+		return nil, err
+	}
+
+	result := &BootstrapResult{
+		Keys:       initResp.Keys,
+		KeysBase64: initResp.KeysB64,
+		RootToken:  initResp.RootToken,
+	}
+
+	encoder := json.NewEncoder(outputFile)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(result); err != nil {
+		return result, fmt.Errorf("writing bootstrap output file: %w", err)
+	}
+	if err = outputFile.Sync(); err != nil {
+		return result, fmt.Errorf("writing bootstrap output file: %w", err)
+	}
+
+	sm.logger.Info("Vault initialized", "shares", opts.SecretShares, "threshold", opts.SecretThreshold, "output", opts.OutputFile)
+
+	if _, err = sm.Unseal(ctx, StaticUnsealKeys(result.Keys[:opts.SecretThreshold]), UnsealOptions{}); err != nil {
+		return result, err
+	}
+
+	sm.vaultClient.SetToken(result.RootToken)
+
+	if result.Mounted, err = sm.ensureKVMount(ctx); err != nil {
+		return result, err
+	}
+
+	folders := make([]string, 0, len(seed))
+	for folder := range seed {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	for _, folder := range folders {
+		if _, err = sm.writeSecretData(ctx, folder, seed[folder], nil); err != nil {
+			sm.logger.Error("Error seeding secrets", "folder", folder, "error", err)
+			return result, err
+		}
+		result.SeededFolders = append(result.SeededFolders, folder)
+	}
+
+	sm.logger.Info("Vault bootstrapped", "mount", sm.kv.mount, "mounted", result.Mounted, "seeded", len(result.SeededFolders))
+
+	return result, nil
+}
+
+// ensureKVMount монтирует KV нужной версии на маунт менеджера, если его еще нет
+func (sm *SecretManagerVault) ensureKVMount(ctx context.Context) (bool, error) {
+	mounts, err := sm.vaultClient.Sys().ListMountsWithContext(ctx)
+	if err != nil {
+		sm.logger.Error("Error listing mounts", "error", err)
+		return false, err
+	}
+
+	if mount, exists := mounts[sm.kv.mount]; exists {
+		if err = checkExistingKVMount(sm.kv, mount); err != nil {
+			sm.logger.Error("Existing mount does not fit the manager", "mount", sm.kv.mount, "error", err)
+		}
+		return false, err
+	}
+
+	err = sm.vaultClient.Sys().MountWithContext(ctx, strings.TrimSuffix(sm.kv.mount, "/"), &vaultapi.MountInput{
+		Type:    "kv",
+		Options: map[string]string{"version": strconv.Itoa(sm.kv.version)},
+	})
+	if err != nil {
+		sm.logger.Error("Error mounting kv", "mount", sm.kv.mount, "error", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// checkExistingKVMount проверяет, что уже смонтированный движок - KV той версии, с которой работает менеджер.
+// Иначе bootstrap прошел бы, а первое же чтение или запись упали
+func checkExistingKVMount(kv kvMount, mount *vaultapi.MountOutput) error {
+	if mount.Type != "kv" && mount.Type != "generic" {
+		return fmt.Errorf("%w: %q has type %q", ErrNotKVMount, kv.mount, mount.Type)
+	}
+
+	version := KVVersion1
+	if mount.Options["version"] == "2" {
+		version = KVVersion2
+	}
+
+	if version != kv.version {
+		return fmt.Errorf("%w: %q is kv v%d, expected v%d", ErrKVVersionMismatch, kv.mount, version, kv.version)
+	}
+
+	return nil
+}
+
+func loadBootstrapSeed(opts BootstrapOptions) (map[string]map[string]any, error) {
+	seed := make(map[string]map[string]any, len(opts.Seed))
+
+	if opts.SeedFile != "" {
+		seedFile, err := os.Open(opts.SeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading seed file: %w", err)
+		}
+		defer seedFile.Close()
+
+		decoder := json.NewDecoder(seedFile)
+		decoder.UseNumber() // большие целые должны доехать до vault'a без потерь
+		if err = decoder.Decode(&seed); err != nil {
+			return nil, fmt.Errorf("%w: seed file %q: %w", ErrInvalidBootstrapOptions, opts.SeedFile, err)
+		}
+	}
+
+	for folder, data := range opts.Seed {
+		seed[folder] = data
+	}
+
+	return seed, nil
+}
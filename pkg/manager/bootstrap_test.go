@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableInit делает фейковый vault неинициализированным: sys/init выдает ключи, sys/mounts монтирует KV
+func (fv *fakeVault) enableInit(t *testing.T) {
+	initialized := false
+	seal := fv.enableSeal(testUnsealKeys, 3)
+	seal.sealed = true
+
+	fv.handle("sys/init", func(r *fakeRequest) any {
+		if r.method == http.MethodGet {
+			return map[string]any{"initialized": initialized}
+		}
+		initialized = true
+		return map[string]any{"keys": testUnsealKeys, "keys_base64": testUnsealKeys, "root_token": "root"}
+	})
+	fv.handle("sys/mounts", func(r *fakeRequest) any {
+		return map[string]any{"data": map[string]any{"sys/": map[string]any{"type": "system"}}}
+	})
+	fv.handle("sys/mounts/kv", func(r *fakeRequest) any {
+		assert.Equal(t, "root", r.token)
+		options, _ := r.body["options"].(map[string]any)
+		version := KVVersion1
+		if options["version"] == "2" {
+			version = KVVersion2
+		}
+		fv.addMount("kv", version)
+		return nil
+	})
+}
+
+func TestBootstrap(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableInit(t)
+
+	dir := t.TempDir()
+	seedFile := filepath.Join(dir, "seed.json")
+	require.NoError(t, os.WriteFile(seedFile, []byte(`{"db/": {"db_password": "secret", "db_port": 5432}}`), 0o600))
+
+	sm, err := NewSecretManager(fv.server.URL, "", testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	outputFile := filepath.Join(dir, "vault-init.json")
+	result, err := sm.Bootstrap(context.Background(), BootstrapOptions{
+		SecretShares:    5,
+		SecretThreshold: 3,
+		OutputFile:      outputFile,
+		SeedFile:        seedFile,
+		Seed:            map[string]map[string]any{"kafka/": {"brokers": "b1:9092"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Mounted)
+	assert.Equal(t, []string{"db/", "kafka/"}, result.SeededFolders)
+	assert.Equal(t, "root", sm.vaultClient.Token())
+
+	info, err := os.Stat(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	raw, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var written BootstrapResult
+	require.NoError(t, json.Unmarshal(raw, &written))
+	assert.Equal(t, testUnsealKeys, written.Keys)
+	assert.Equal(t, "root", written.RootToken)
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, config{"db_password": "secret", "db_port": json.Number("5432"), "brokers": "b1:9092"}, sm.config)
+
+	_, err = sm.Bootstrap(context.Background(), BootstrapOptions{SecretShares: 1, SecretThreshold: 1, OutputFile: filepath.Join(dir, "again.json")})
+	assert.True(t, errors.Is(err, ErrAlreadyInitialized))
+}
+
+var bootstrapExistingMountTests = []struct {
+	name        string
+	mount       map[string]any
+	expectedErr error
+}{
+	{"kv v2", map[string]any{"type": "kv", "options": map[string]any{"version": "2"}}, nil},
+	{"kv v1", map[string]any{"type": "kv", "options": map[string]any{"version": "1"}}, ErrKVVersionMismatch},
+	{"generic", map[string]any{"type": "generic"}, ErrKVVersionMismatch},
+	{"not kv", map[string]any{"type": "transit"}, ErrNotKVMount},
+}
+
+func TestBootstrapExistingMount(t *testing.T) {
+	for _, test := range bootstrapExistingMountTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.enableInit(t)
+			fv.addMount("kv", KVVersion2)
+			fv.handle("sys/mounts", func(r *fakeRequest) any {
+				return map[string]any{"data": map[string]any{"sys/": map[string]any{"type": "system"}, "kv/": test.mount}}
+			})
+
+			sm, err := NewSecretManager(fv.server.URL, "", testBasePathData, testBasePathMetadata, nilZapLogger)
+			require.NoError(t, err)
+
+			result, err := sm.Bootstrap(context.Background(), BootstrapOptions{
+				SecretShares:    5,
+				SecretThreshold: 3,
+				OutputFile:      filepath.Join(t.TempDir(), "vault-init.json"),
+				Seed:            map[string]map[string]any{"db/": {"db_password": "secret"}},
+			})
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.False(t, result.Mounted)
+			if test.expectedErr == nil {
+				assert.Equal(t, []string{"db/"}, result.SeededFolders)
+			} else {
+				assert.Empty(t, result.SeededFolders)
+			}
+		})
+	}
+}
+
+var bootstrapOptionsTests = []struct {
+	name string
+	opts BootstrapOptions
+}{
+	{"no shares", BootstrapOptions{SecretThreshold: 1, OutputFile: "out.json"}},
+	{"threshold above shares", BootstrapOptions{SecretShares: 3, SecretThreshold: 4, OutputFile: "out.json"}},
+	{"no output file", BootstrapOptions{SecretShares: 3, SecretThreshold: 2}},
+}
+
+func TestBootstrapOptionsValidation(t *testing.T) {
+	for _, test := range bootstrapOptionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, errors.Is(test.opts.validate(), ErrInvalidBootstrapOptions))
+		})
+	}
+}
+
+func TestBootstrapDoesNotOverwriteOutput(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableInit(t)
+
+	outputFile := filepath.Join(t.TempDir(), "vault-init.json")
+	require.NoError(t, os.WriteFile(outputFile, []byte("old keys"), 0o600))
+
+	sm, err := NewSecretManager(fv.server.URL, "", testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	_, err = sm.Bootstrap(context.Background(), BootstrapOptions{SecretShares: 5, SecretThreshold: 3, OutputFile: outputFile})
+	assert.True(t, errors.Is(err, os.ErrExist))
+
+	initialized, err := sm.vaultClient.Sys().InitStatus()
+	require.NoError(t, err)
+	assert.False(t, initialized)
+}
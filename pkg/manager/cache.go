@@ -0,0 +1,351 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	configCacheVersion = 1
+	configCacheKeyInfo = "vault-config-manager config cache"
+	configCacheKeySize = 32
+)
+
+var (
+	ErrInvalidCacheOptions = errors.New("invalid config cache options")
+	ErrConfigCacheExpired  = errors.New("config cache is too old")
+	ErrConfigCacheCorrupt  = errors.New("config cache is corrupt or encrypted with another key")
+)
+
+// ConfigCacheOptions - локальный кэш последнего удачного конфига на диске, чтобы сервис мог подняться без vault'a.
+// Ключ шифрования - либо Secret, либо TransitKey, ровно один из них.
+//
+// С TransitKey файл шифруется datakey'ем из <transit>/datakey/plaintext/<key>, а сам datakey лежит рядом, зашифрованный
+// transit'ом. Расшифровать такой кэш можно только при живом transit, то есть он спасает, когда недоступен KV,
+// но не весь vault: если не отвечает и transit, ReloadConfig вернет ошибку vault'a вместе с ошибкой расшифровки.
+// Для старта при полностью лежащем vault'e нужен Secret.
+//
+// Кэш переписывается, только когда конфиг поменялся или записанному осталось меньше половины MaxAge
+type ConfigCacheOptions struct {
+	// Path - файл кэша, пишется атомарно с правами 0600
+	Path string
+	// MaxAge - кэш старше этого при старте не используется
+	MaxAge time.Duration
+	// Secret - локальный секрет (например, из файла или k8s secret), ключ выводится из него через HKDF
+	Secret []byte
+	// TransitKey - ключ transit для datakey, маунт - из WithTransit/SetTransitKey
+	TransitKey string
+}
+
+func (o ConfigCacheOptions) validate() error {
+	switch {
+	case o.Path == "":
+		return fmt.Errorf("%w: empty path", ErrInvalidCacheOptions)
+	case o.MaxAge <= 0:
+		return fmt.Errorf("%w: max age must be positive", ErrInvalidCacheOptions)
+	case len(o.Secret) == 0 && o.TransitKey == "":
+		return fmt.Errorf("%w: either secret or transit key is required", ErrInvalidCacheOptions)
+	case len(o.Secret) > 0 && o.TransitKey != "":
+		return fmt.Errorf("%w: secret and transit key are mutually exclusive", ErrInvalidCacheOptions)
+	}
+
+	return nil
+}
+
+// configCache - настройки кэша и datakey transit'a, чтобы не ходить за новым на каждом обновлении
+type configCache struct {
+	sync.Mutex
+	opts ConfigCacheOptions
+
+	dataKey        []byte
+	wrappedDataKey string
+
+	// то, что сейчас лежит на диске, чтобы не переписывать файл на каждом обновлении без изменений
+	saved   config
+	savedAt time.Time
+}
+
+// upToDate - на диске тот же конфиг и он не успеет протухнуть до следующих обновлений
+func (c *configCache) upToDate(cfg config, now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.saved != nil && !areConfigsDifferent(c.saved, cfg) && now.Sub(c.savedAt) < c.opts.MaxAge/2
+}
+
+func (c *configCache) remember(cfg config, savedAt time.Time) {
+	c.Lock()
+	c.saved, c.savedAt = maps.Clone(cfg), savedAt
+	c.Unlock()
+}
+
+// configCacheFile - то, что лежит на диске. Открытого текста тут нет, время записи - внутри шифротекста
+type configCacheFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt,omitempty"`
+	DataKey    string `json:"data_key,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type configCachePayload struct {
+	SavedAt time.Time `json:"saved_at"`
+	Config  config    `json:"config"`
+}
+
+// startFromConfigCache поднимает конфиг из кэша, когда vault недоступен при старте. Если кэша нет, он протух
+// или не расшифровывается, возвращается исходная ошибка vault'a вместе с причиной
+func (sm *SecretManagerVault) startFromConfigCache(vaultErr error) error {
+	savedAt, err := sm.loadConfigCache(context.Background())
+	if err != nil {
+		sm.logger.Error("Vault is unreachable and config cache is unusable", "path", sm.cache.opts.Path, "error", errors.Join(vaultErr, err))
+		return errors.Join(vaultErr, err)
+	}
+
+	sm.stateMu.Lock()
+	sm.state.servedFromCache = true
+	sm.state.cacheSavedAt = savedAt
+	sm.stateMu.Unlock()
+
+	sm.logger.Warn("Vault is unreachable, serving config from cache",
+		"path", sm.cache.opts.Path, "savedAt", savedAt, "age", time.Since(savedAt).Round(time.Second), "error", vaultErr)
+
+	return nil
+}
+
+// writeConfigCache сохраняет конфиг после удачного обновления. Ошибки только логируются и видны в Status,
+// обновление конфига из-за них не ломается
+func (sm *SecretManagerVault) writeConfigCache(cfg config) {
+	if sm.cache == nil {
+		return
+	}
+
+	now := time.Now()
+	if sm.cache.upToDate(cfg, now) {
+		return
+	}
+
+	err := sm.saveConfigCache(context.Background(), cfg, now)
+	if err != nil {
+		sm.logger.Error("Error writing config cache", "path", sm.cache.opts.Path, "error", err)
+	} else {
+		sm.cache.remember(cfg, now)
+	}
+
+	sm.stateMu.Lock()
+	sm.state.cacheWriteError = err
+	sm.stateMu.Unlock()
+}
+
+func (sm *SecretManagerVault) saveConfigCache(ctx context.Context, cfg config, savedAt time.Time) error {
+	plaintext, err := json.Marshal(configCachePayload{SavedAt: savedAt, Config: cfg})
+	if err != nil {
+		return err
+	}
+
+	file := configCacheFile{Version: configCacheVersion}
+
+	var key []byte
+	if len(sm.cache.opts.Secret) > 0 {
+		file.Salt = make([]byte, 16)
+		if _, err = rand.Read(file.Salt); err != nil {
+			return err
+		}
+		key, err = hkdf.Key(sha256.New, sm.cache.opts.Secret, file.Salt, configCacheKeyInfo, configCacheKeySize)
+	} else {
+		key, file.DataKey, err = sm.cacheDataKey(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	aead, err := newCacheAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	// путь в additional data: кэш другого сервиса или префикса не расшифруется
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, []byte(sm.basePath))
+
+	encoded, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(sm.cache.opts.Path, encoded)
+}
+
+// loadConfigCache читает кэш и ставит его конфигом, если он не старше MaxAge. Возвращает время записи кэша
+func (sm *SecretManagerVault) loadConfigCache(ctx context.Context) (time.Time, error) {
+	encoded, err := os.ReadFile(sm.cache.opts.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var file configCacheFile
+	if err = json.Unmarshal(encoded, &file); err != nil || file.Version != configCacheVersion {
+		return time.Time{}, fmt.Errorf("%w: unknown format", ErrConfigCacheCorrupt)
+	}
+
+	var key []byte
+	switch {
+	case len(sm.cache.opts.Secret) > 0 && len(file.Salt) > 0:
+		key, err = hkdf.Key(sha256.New, sm.cache.opts.Secret, file.Salt, configCacheKeyInfo, configCacheKeySize)
+	case sm.cache.opts.TransitKey != "" && file.DataKey != "":
+		key, err = sm.unwrapCacheDataKey(ctx, file.DataKey)
+	default:
+		return time.Time{}, fmt.Errorf("%w: written with another key type", ErrConfigCacheCorrupt)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	aead, err := newCacheAEAD(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(file.Nonce) != aead.NonceSize() {
+		return time.Time{}, fmt.Errorf("%w: bad nonce", ErrConfigCacheCorrupt)
+	}
+
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, []byte(sm.basePath))
+	if err != nil {
+		return time.Time{}, ErrConfigCacheCorrupt
+	}
+
+	var payload configCachePayload
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.UseNumber() // как при чтении из vault'a
+	if err = decoder.Decode(&payload); err != nil {
+		return time.Time{}, fmt.Errorf("%w: %w", ErrConfigCacheCorrupt, err)
+	}
+
+	if age := time.Since(payload.SavedAt); age > sm.cache.opts.MaxAge {
+		return payload.SavedAt, fmt.Errorf("%w: saved %s ago, max age %s", ErrConfigCacheExpired, age.Round(time.Second), sm.cache.opts.MaxAge)
+	}
+
+	if payload.Config == nil {
+		payload.Config = make(config)
+	}
+	sm.cache.remember(payload.Config, payload.SavedAt)
+	sm.setConfig(payload.Config)
+
+	return payload.SavedAt, nil
+}
+
+// cacheDataKey - datakey transit'a для записи кэша, открытый и зашифрованный. Берется один раз на процесс
+func (sm *SecretManagerVault) cacheDataKey(ctx context.Context) ([]byte, string, error) {
+	sm.cache.Lock()
+	defer sm.cache.Unlock()
+
+	if sm.cache.dataKey != nil {
+		return sm.cache.dataKey, sm.cache.wrappedDataKey, nil
+	}
+
+	mount, key, err := sm.transitTarget(sm.cache.opts.TransitKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := sm.vaultClient.Logical().WriteWithContext(ctx, mount+"datakey/plaintext/"+key, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, "", ErrEmptyVaultResponse
+	}
+
+	encodedKey, _ := resp.Data["plaintext"].(string)
+	wrapped, _ := resp.Data["ciphertext"].(string)
+	dataKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || wrapped == "" {
+		return nil, "", ErrEmptyVaultResponse
+	}
+
+	sm.cache.dataKey, sm.cache.wrappedDataKey = dataKey, wrapped
+	return dataKey, wrapped, nil
+}
+
+// unwrapCacheDataKey расшифровывает datakey из файла кэша и запоминает его для следующих записей
+func (sm *SecretManagerVault) unwrapCacheDataKey(ctx context.Context, wrapped string) ([]byte, error) {
+	dataKey, err := sm.Decrypt(ctx, sm.cache.opts.TransitKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.cache.Lock()
+	sm.cache.dataKey, sm.cache.wrappedDataKey = dataKey, wrapped
+	sm.cache.Unlock()
+
+	return dataKey, nil
+}
+
+func newCacheAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigCacheCorrupt, err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic пишет во временный файл рядом и переименовывает, чтобы упавший посреди записи процесс
+// не оставил обрезанный кэш
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// isVaultUnreachable - ошибка похожа на недоступный vault (сеть, таймаут, 5xx), а не на проблему с правами или данными
+func isVaultUnreachable(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var respErr *vaultapi.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode >= http.StatusInternalServerError
+}
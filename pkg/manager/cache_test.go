@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cacheTestSetup = testManagerSetup{
+	mounts: map[string]int{"kv": KVVersion2},
+	secrets: map[string]map[string]any{
+		"kv/main/db": {"db_password": "hunter2", "db_port": 5432},
+	},
+	options: []Option{WithMaxRetries(0), WithBasePaths("kv/data/main/", "kv/metadata/main/")},
+}
+
+func TestConfigCacheOfflineStartup(t *testing.T) {
+	fv := cacheTestSetup.newFakeVault(t)
+
+	opts := ConfigCacheOptions{
+		Path:   filepath.Join(t.TempDir(), "config.cache"),
+		MaxAge: time.Hour,
+		Secret: []byte("local secret"),
+	}
+
+	sm := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	require.NoError(t, sm.ReloadConfig())
+	assert.False(t, sm.Status().ServedFromCache)
+	assert.NoError(t, sm.Status().CacheWriteError)
+
+	encoded, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "hunter2")
+
+	info, err := os.Stat(opts.Path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	fv.server.Close()
+
+	offline := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	require.NoError(t, offline.ReloadConfig())
+	assert.Equal(t, config{"db_password": "hunter2", "db_port": json.Number("5432")}, offline.config)
+
+	status := offline.Status()
+	assert.True(t, status.ServedFromCache)
+	assert.WithinDuration(t, time.Now(), status.CacheSavedAt, time.Minute)
+	assert.Error(t, status.LastRefreshError)
+
+	// кэш от другого пути не подходит
+	other := cacheTestSetup.newManager(t, fv, WithConfigCache(opts), WithBasePaths("kv/data/other/", "kv/metadata/other/"))
+	assert.True(t, errors.Is(other.ReloadConfig(), ErrConfigCacheCorrupt))
+}
+
+var configCacheRejectedTests = []struct {
+	name   string
+	secret string
+	maxAge time.Duration
+	err    error
+}{
+	{"wrong secret", "another secret", time.Hour, ErrConfigCacheCorrupt},
+	{"too old", "local secret", time.Nanosecond, ErrConfigCacheExpired},
+}
+
+func TestConfigCacheRejected(t *testing.T) {
+	for _, test := range configCacheRejectedTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv := cacheTestSetup.newFakeVault(t)
+
+			path := filepath.Join(t.TempDir(), "config.cache")
+			sm := cacheTestSetup.newManager(t, fv, WithConfigCache(ConfigCacheOptions{Path: path, MaxAge: time.Hour, Secret: []byte("local secret")}))
+			require.NoError(t, sm.ReloadConfig())
+
+			fv.server.Close()
+
+			offline := cacheTestSetup.newManager(t, fv, WithConfigCache(ConfigCacheOptions{Path: path, MaxAge: test.maxAge, Secret: []byte(test.secret)}))
+			err := offline.ReloadConfig()
+			assert.True(t, errors.Is(err, test.err), "got error %v", err)
+			assert.False(t, offline.Status().ServedFromCache)
+			assert.Empty(t, offline.config)
+		})
+	}
+}
+
+func TestConfigCacheNotUsedWhenVaultAnswers(t *testing.T) {
+	fv := cacheTestSetup.newFakeVault(t)
+
+	opts := ConfigCacheOptions{Path: filepath.Join(t.TempDir(), "config.cache"), MaxAge: time.Hour, Secret: []byte("local secret")}
+	require.NoError(t, cacheTestSetup.newManager(t, fv, WithConfigCache(opts)).ReloadConfig())
+
+	// отказ в доступе - не недоступный vault, из кэша не поднимаемся
+	fv.handle("kv/metadata/main", func(r *fakeRequest) any {
+		return &fakeVaultError{code: http.StatusForbidden, messages: []string{"permission denied"}}
+	})
+
+	sm := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	assert.Error(t, sm.ReloadConfig())
+	assert.False(t, sm.Status().ServedFromCache)
+}
+
+func TestConfigCacheTransitDataKey(t *testing.T) {
+	fv := cacheTestSetup.newFakeVault(t)
+	fv.enableTransit("transit", "cache")
+
+	dataKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	fv.handle("transit/datakey/plaintext/cache", func(r *fakeRequest) any {
+		return map[string]any{"data": map[string]any{"plaintext": dataKey, "ciphertext": "vault:v1:" + dataKey}}
+	})
+
+	opts := ConfigCacheOptions{Path: filepath.Join(t.TempDir(), "config.cache"), MaxAge: time.Hour, TransitKey: "cache"}
+	require.NoError(t, cacheTestSetup.newManager(t, fv, WithConfigCache(opts)).ReloadConfig())
+
+	encoded, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), "vault:v1:")
+
+	// KV отвечает 503, transit жив - datakey расшифровывается
+	fv.handle("kv/metadata/main", func(r *fakeRequest) any {
+		return &fakeVaultError{code: http.StatusServiceUnavailable, messages: []string{"unavailable"}}
+	})
+
+	sm := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	require.NoError(t, sm.ReloadConfig())
+	assert.True(t, sm.Status().ServedFromCache)
+
+	password, err := sm.GetSecretStringFromConfig("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+
+	// vault лежит целиком - datakey не расшифровать, кэш с TransitKey тут не спасает
+	fv.server.Close()
+
+	down := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	assert.Error(t, down.ReloadConfig())
+	assert.False(t, down.Status().ServedFromCache)
+	assert.Empty(t, down.config)
+}
+
+func TestConfigCacheSkipsUnchangedConfig(t *testing.T) {
+	fv := cacheTestSetup.newFakeVault(t)
+	opts := ConfigCacheOptions{Path: filepath.Join(t.TempDir(), "config.cache"), MaxAge: time.Hour, Secret: []byte("local secret")}
+
+	sm := cacheTestSetup.newManager(t, fv, WithConfigCache(opts))
+	require.NoError(t, sm.ReloadConfig())
+	written, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+
+	// конфиг тот же - файл не трогаем, иначе соль и nonce поменялись бы
+	require.NoError(t, sm.ReloadConfig())
+	unchanged, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+	assert.Equal(t, written, unchanged)
+
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "hunter3", "db_port": 5432})
+	require.NoError(t, sm.ReloadConfig())
+	changed, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+	assert.NotEqual(t, written, changed)
+
+	// тот же конфиг, но записанному уже больше половины MaxAge - переписываем, чтобы кэш не протух
+	sm.cache.savedAt = time.Now().Add(-opts.MaxAge / 2)
+	require.NoError(t, sm.ReloadConfig())
+	refreshed, err := os.ReadFile(opts.Path)
+	require.NoError(t, err)
+	assert.NotEqual(t, changed, refreshed)
+	assert.WithinDuration(t, time.Now(), sm.cache.savedAt, time.Minute)
+}
+
+var invalidCacheOptionsTests = []struct {
+	name string
+	opts ConfigCacheOptions
+}{
+	{"no path", ConfigCacheOptions{MaxAge: time.Hour, Secret: []byte("s")}},
+	{"no max age", ConfigCacheOptions{Path: "cache", Secret: []byte("s")}},
+	{"no key", ConfigCacheOptions{Path: "cache", MaxAge: time.Hour}},
+	{"both keys", ConfigCacheOptions{Path: "cache", MaxAge: time.Hour, Secret: []byte("s"), TransitKey: "cache"}},
+}
+
+func TestInvalidCacheOptions(t *testing.T) {
+	for _, test := range invalidCacheOptionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewSecretManagerWithOptions(WithConfigCache(test.opts))
+			assert.True(t, errors.Is(err, ErrInvalidCacheOptions), "got error %v", err)
+		})
+	}
+}
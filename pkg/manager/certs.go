@@ -0,0 +1,359 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPKIMount - маунт PKI secrets engine по умолчанию
+	DefaultPKIMount = "pki"
+	// DefaultCertificateCheckInterval - как часто StartRenewer смотрит на срок сертификата
+	DefaultCertificateCheckInterval = time.Minute
+	// certificateRenewFraction - какая доля жизни сертификата должна пройти до перевыпуска
+	certificateRenewFraction = 2.0 / 3.0
+)
+
+var (
+	ErrInvalidCertificateOptions = errors.New("invalid certificate options")
+	ErrInvalidCertificate        = errors.New("invalid certificate material")
+)
+
+// CertificateOptions - откуда брать сертификат: выписывать в PKI (PKIRole) или читать из ключей конфига (CertKey/KeyKey)
+type CertificateOptions struct {
+	// PKIMount - маунт PKI, по умолчанию DefaultPKIMount
+	PKIMount string
+	// PKIRole - роль для pki/issue/<role>
+	PKIRole    string
+	CommonName string
+	AltNames   []string
+	IPSANs     []string
+	// TTL - запрашиваемый срок, 0 - срок роли
+	TTL time.Duration
+
+	// CertKey, KeyKey и CAKey - ключи конфига (можно с путями, как в Get) с PEM сертификата (с цепочкой),
+	// приватного ключа и CA. CAKey необязателен. Значения обновляет апдейтер конфига
+	CertKey string
+	KeyKey  string
+	CAKey   string
+
+	// RenewBefore - перевыпускать, когда до NotAfter осталось меньше. По умолчанию - когда прошло 2/3 жизни сертификата
+	RenewBefore time.Duration
+	// CheckInterval - как часто StartRenewer проверяет сертификат, по умолчанию DefaultCertificateCheckInterval
+	CheckInterval time.Duration
+}
+
+func (opts CertificateOptions) validate() error {
+	fromPKI := opts.PKIRole != ""
+	fromKV := opts.CertKey != "" || opts.KeyKey != "" || opts.CAKey != ""
+
+	switch {
+	case fromPKI == fromKV:
+		return fmt.Errorf("%w: exactly one of PKIRole and CertKey/KeyKey is required", ErrInvalidCertificateOptions)
+	case fromPKI && opts.CommonName == "":
+		return fmt.Errorf("%w: CommonName is required for PKI issuance", ErrInvalidCertificateOptions)
+	case fromKV && (opts.CertKey == "" || opts.KeyKey == ""):
+		return fmt.Errorf("%w: both CertKey and KeyKey are required", ErrInvalidCertificateOptions)
+	}
+
+	return nil
+}
+
+// certificateMaterial - то, что сейчас раздает CertificateManager
+type certificateMaterial struct {
+	cert   *tls.Certificate
+	leaf   *x509.Certificate
+	caPool *x509.CertPool
+	// pem - исходные PEM, чтобы не пересобирать сертификат из конфига, если ничего не поменялось
+	pem string
+}
+
+// CertificateManager держит актуальный сертификат из vault'a и отдает его через tls.Config с колбэками,
+// так что смена сертификата не требует рестарта
+type CertificateManager struct {
+	sm   *SecretManagerVault
+	opts CertificateOptions
+
+	mu       sync.RWMutex
+	material *certificateMaterial
+}
+
+// NewCertificateManager сразу получает первый сертификат, чтобы TLSConfig был рабочим с самого начала
+func (sm *SecretManagerVault) NewCertificateManager(ctx context.Context, opts CertificateOptions) (*CertificateManager, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.PKIMount == "" {
+		opts.PKIMount = DefaultPKIMount
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = DefaultCertificateCheckInterval
+	}
+
+	cm := &CertificateManager{sm: sm, opts: opts}
+	if err := cm.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// Certificate - текущий сертификат
+func (cm *CertificateManager) Certificate() *tls.Certificate {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.material.cert
+}
+
+// Leaf - разобранный текущий сертификат, для NotAfter и прочего
+func (cm *CertificateManager) Leaf() *x509.Certificate {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.material.leaf
+}
+
+// CAPool - текущий CA, nil если его нет
+func (cm *CertificateManager) CAPool() *x509.CertPool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.material.caPool
+}
+
+// TLSConfig - конфиг для сервера и mTLS-клиента. GetCertificate и GetClientCertificate всегда отдают текущий сертификат,
+// GetConfigForClient подставляет актуальный CA в ClientCAs. Остальные поля (ClientAuth, MinVersion, ...) можно менять
+// после вызова, они подхватываются на каждом рукопожатии. RootCAs - снимок CA на момент вызова, клиентам,
+// которым нужна ротация CA без пересоздания конфига, нужен ClientTLSConfig
+func (cm *CertificateManager) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cm.Certificate(), nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cm.Certificate(), nil
+		},
+		RootCAs: cm.CAPool(),
+	}
+
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		perConn := cfg.Clone()
+		perConn.GetConfigForClient = nil
+		if pool := cm.CAPool(); pool != nil {
+			perConn.ClientCAs = pool
+		}
+		return perConn, nil
+	}
+
+	return cfg
+}
+
+// ClientTLSConfig - конфиг для клиента, который проверяет сервер по текущему CA на каждом рукопожатии.
+// Стандартная проверка отключается и делается заново в VerifyConnection, как в примере из crypto/tls.
+// Без CA сервер проверяется по системным корням
+func (cm *CertificateManager) ClientTLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cm.Certificate(), nil
+		},
+		InsecureSkipVerify: true, // проверка ниже, в VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("%w: server sent no certificates", ErrInvalidCertificate)
+			}
+
+			verifyOpts := x509.VerifyOptions{
+				Roots:         cm.CAPool(),
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				verifyOpts.Intermediates.AddCert(cert)
+			}
+
+			_, err := cs.PeerCertificates[0].Verify(verifyOpts)
+			return err
+		},
+	}
+}
+
+// Reload получает сертификат заново: выписывает новый в PKI или перечитывает ключи конфига
+func (cm *CertificateManager) Reload(ctx context.Context) error {
+	var material *certificateMaterial
+	var err error
+	if cm.opts.PKIRole != "" {
+		material, err = cm.issue(ctx)
+	} else {
+		material, err = cm.loadFromConfig()
+	}
+	if err != nil {
+		cm.sm.logger.Error("Error loading certificate", "error", err)
+		return err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.material != nil && cm.material.pem == material.pem {
+		return nil
+	}
+	cm.material = material
+
+	cm.sm.logger.Info("Certificate loaded",
+		"subject", material.leaf.Subject.CommonName, "serial", material.leaf.SerialNumber.String(), "not_after", material.leaf.NotAfter)
+
+	return nil
+}
+
+// StartRenewer блокирующе следит за сертификатом, запускать в отдельной горутине. Сертификат из PKI
+// перевыпускается заранее, до NotAfter, а из KV перечитывается из конфига, который обновляет апдейтер.
+// Останавливается через StopUpdater
+func (cm *CertificateManager) StartRenewer() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-cm.sm.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(cm.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.sm.stopChan:
+			return
+		case <-ticker.C:
+			cm.maybeRenew(ctx, time.Now())
+		}
+	}
+}
+
+// maybeRenew - один шаг StartRenewer по состоянию на now
+func (cm *CertificateManager) maybeRenew(ctx context.Context, now time.Time) {
+	if cm.opts.PKIRole == "" {
+		if err := cm.Reload(ctx); err != nil {
+			return
+		}
+		if leaf := cm.Leaf(); now.After(cm.renewAt(leaf)) {
+			cm.sm.logger.Warn("Certificate from config is close to expiry", "not_after", leaf.NotAfter)
+		}
+		return
+	}
+
+	leaf := cm.Leaf()
+	if now.Before(cm.renewAt(leaf)) {
+		return
+	}
+
+	cm.sm.logger.Info("Renewing certificate", "serial", leaf.SerialNumber.String(), "not_after", leaf.NotAfter)
+	_ = cm.Reload(ctx) // ошибка уже в логе, старый сертификат продолжает работать до следующей попытки
+}
+
+func (cm *CertificateManager) renewAt(leaf *x509.Certificate) time.Time {
+	if cm.opts.RenewBefore > 0 {
+		return leaf.NotAfter.Add(-cm.opts.RenewBefore)
+	}
+
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(time.Duration(float64(lifetime) * certificateRenewFraction))
+}
+
+func (cm *CertificateManager) issue(ctx context.Context) (*certificateMaterial, error) {
+	request := map[string]any{"common_name": cm.opts.CommonName}
+	if len(cm.opts.AltNames) > 0 {
+		request["alt_names"] = strings.Join(cm.opts.AltNames, ",")
+	}
+	if len(cm.opts.IPSANs) > 0 {
+		request["ip_sans"] = strings.Join(cm.opts.IPSANs, ",")
+	}
+	if cm.opts.TTL > 0 {
+		request["ttl"] = cm.opts.TTL.String()
+	}
+
+	path := normalizeMount(cm.opts.PKIMount) + "issue/" + cm.opts.PKIRole
+	resp, err := cm.sm.vaultClient.Logical().WriteWithContext(ctx, path, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	certPEM, _ := resp.Data["certificate"].(string)
+	keyPEM, _ := resp.Data["private_key"].(string)
+
+	var chain []string
+	if rawChain, ok := resp.Data["ca_chain"].([]any); ok {
+		for _, raw := range rawChain {
+			if ca, ok := raw.(string); ok {
+				chain = append(chain, ca)
+			}
+		}
+	}
+	if issuingCA, _ := resp.Data["issuing_ca"].(string); len(chain) == 0 && issuingCA != "" {
+		chain = append(chain, issuingCA)
+	}
+
+	return parseCertificateMaterial(certPEM+"\n"+strings.Join(chain, "\n"), keyPEM, strings.Join(chain, "\n"))
+}
+
+func (cm *CertificateManager) loadFromConfig() (*certificateMaterial, error) {
+	certPEM, err := cm.sm.GetString(cm.opts.CertKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", cm.opts.CertKey, err)
+	}
+
+	keyPEM, err := cm.sm.GetString(cm.opts.KeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", cm.opts.KeyKey, err)
+	}
+
+	var caPEM string
+	if cm.opts.CAKey != "" {
+		if caPEM, err = cm.sm.GetString(cm.opts.CAKey); err != nil {
+			return nil, fmt.Errorf("reading %q: %w", cm.opts.CAKey, err)
+		}
+	}
+
+	return parseCertificateMaterial(certPEM, keyPEM, caPEM)
+}
+
+func parseCertificateMaterial(certPEM, keyPEM, caPEM string) (*certificateMaterial, error) {
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+	cert.Leaf = leaf
+
+	material := &certificateMaterial{cert: &cert, leaf: leaf, pem: certPEM + keyPEM + caPEM}
+
+	if strings.TrimSpace(caPEM) != "" {
+		material.caPool = x509.NewCertPool()
+		if !material.caPool.AppendCertsFromPEM([]byte(caPEM)) {
+			return nil, fmt.Errorf("%w: no certificates in ca bundle", ErrInvalidCertificate)
+		}
+	}
+
+	return material, nil
+}
@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pemEncode(blockType string, der []byte) string {
+	var buf bytes.Buffer
+	_ = pem.Encode(&buf, &pem.Block{Type: blockType, Bytes: der})
+	return buf.String()
+}
+
+// fakePKI - CA в памяти, который выписывает сертификаты как pki/issue/<role>
+type fakePKI struct {
+	mu     sync.Mutex
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPEM  string
+	serial int64
+}
+
+func newFakePKI(t *testing.T) *fakePKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &fakePKI{ca: ca, caKey: caKey, caPEM: pemEncode("CERTIFICATE", der), serial: 1}
+}
+
+func (p *fakePKI) issue(t *testing.T, commonName string, ttl time.Duration) (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER)
+}
+
+func (fv *fakeVault) enablePKI(t *testing.T, role string) *fakePKI {
+	pki := newFakePKI(t)
+
+	fv.handle("pki/issue/"+role, func(r *fakeRequest) any {
+		ttl := time.Hour
+		if raw, ok := r.body["ttl"].(string); ok {
+			ttl, _ = time.ParseDuration(raw)
+		}
+		commonName, _ := r.body["common_name"].(string)
+
+		certPEM, keyPEM := pki.issue(t, commonName, ttl)
+		return map[string]any{"data": map[string]any{
+			"certificate": certPEM,
+			"private_key": keyPEM,
+			"issuing_ca":  pki.caPEM,
+			"ca_chain":    []string{pki.caPEM},
+		}}
+	})
+
+	return pki
+}
+
+// handshake гоняет mTLS-рукопожатие через net.Pipe и возвращает серийник сертификата сервера
+func handshake(t *testing.T, server, client *tls.Config) *big.Int {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- tls.Server(serverConn, server).Handshake()
+	}()
+
+	tlsClient := tls.Client(clientConn, client)
+	require.NoError(t, tlsClient.Handshake())
+	require.NoError(t, <-serverErr)
+
+	return tlsClient.ConnectionState().PeerCertificates[0].SerialNumber
+}
+
+func TestCertificateManagerPKI(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enablePKI(t, "web")
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	cm, err := sm.NewCertificateManager(ctx, CertificateOptions{
+		PKIRole:    "web",
+		CommonName: "web.local",
+		TTL:        time.Hour,
+	})
+	require.NoError(t, err)
+
+	leaf := cm.Leaf()
+	assert.Equal(t, "web.local", leaf.Subject.CommonName)
+
+	serverConfig := cm.TLSConfig()
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	clientConfig := cm.ClientTLSConfig("web.local")
+
+	assert.Equal(t, leaf.SerialNumber, handshake(t, serverConfig, clientConfig))
+
+	// до 2/3 жизни сертификата перевыпуска нет
+	cm.maybeRenew(ctx, leaf.NotBefore.Add(30*time.Minute))
+	assert.Equal(t, leaf.SerialNumber, cm.Leaf().SerialNumber)
+
+	cm.maybeRenew(ctx, leaf.NotAfter.Add(-10*time.Minute))
+	renewed := cm.Leaf()
+	assert.NotEqual(t, leaf.SerialNumber, renewed.SerialNumber)
+
+	// те же конфиги без пересоздания уже отдают новый сертификат
+	assert.Equal(t, renewed.SerialNumber, handshake(t, serverConfig, clientConfig))
+}
+
+func TestCertificateManagerKV(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	pki := newFakePKI(t)
+
+	certPEM, keyPEM := pki.issue(t, "api.local", time.Hour)
+	fv.putSecret("kv/main/tls", map[string]any{"tls": map[string]any{"cert": certPEM, "key": keyPEM, "ca": pki.caPEM}})
+	require.NoError(t, sm.ReloadConfig())
+
+	ctx := context.Background()
+	cm, err := sm.NewCertificateManager(ctx, CertificateOptions{CertKey: "tls.cert", KeyKey: "tls.key", CAKey: "tls.ca"})
+	require.NoError(t, err)
+	first := cm.Leaf().SerialNumber
+
+	certPEM, keyPEM = pki.issue(t, "api.local", time.Hour)
+	fv.putSecret("kv/main/tls", map[string]any{"tls": map[string]any{"cert": certPEM, "key": keyPEM, "ca": pki.caPEM}})
+	require.NoError(t, sm.ReloadConfig())
+
+	cm.maybeRenew(ctx, time.Now())
+	assert.NotEqual(t, first, cm.Leaf().SerialNumber)
+
+	// битый PEM в конфиге не ломает уже загруженный сертификат
+	fv.putSecret("kv/main/tls", map[string]any{"tls": map[string]any{"cert": "garbage", "key": keyPEM, "ca": pki.caPEM}})
+	require.NoError(t, sm.ReloadConfig())
+	assert.True(t, errors.Is(cm.Reload(ctx), ErrInvalidCertificate))
+	assert.NotNil(t, cm.Certificate())
+}
+
+var certificateOptionsTests = []struct {
+	name string
+	opts CertificateOptions
+}{
+	{"nothing", CertificateOptions{}},
+	{"both sources", CertificateOptions{PKIRole: "web", CommonName: "web", CertKey: "cert", KeyKey: "key"}},
+	{"no common name", CertificateOptions{PKIRole: "web"}},
+	{"no key", CertificateOptions{CertKey: "cert"}},
+}
+
+func TestCertificateOptionsValidation(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	for _, test := range certificateOptionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := sm.NewCertificateManager(context.Background(), test.opts)
+			assert.True(t, errors.Is(err, ErrInvalidCertificateOptions))
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrInvalidConnectorOptions = errors.New("invalid connector options")
+	ErrTxOptionsNotSupported   = errors.New("driver does not support non-default transaction options")
+)
+
+// ConnectorOptions - откуда RotatingConnector берет драйвер и DSN
+type ConnectorOptions struct {
+	// DriverName - имя зарегистрированного драйвера, например "pgx" или "mysql". Либо он, либо Driver
+	DriverName string
+	Driver     driver.Driver
+
+	// DSNKey - ключ конфига, в котором лежит готовый DSN. Либо он, либо BuildDSN
+	DSNKey string
+
+	// Keys - ключи конфига (можно с путями, как в Get), значения которых уходят в BuildDSN под теми же именами
+	Keys []string
+	// DatabaseRole - брать логин и пароль из динамических кредов DatabaseCredentials, в BuildDSN они приходят
+	// под ключами "username" и "password"
+	DatabaseRole string
+	// BuildDSN собирает DSN из значений. Вызывается на каждое новое соединение и на каждую проверку
+	// соединения при возврате в пул, поэтому должна быть дешевой и без походов в сеть
+	BuildDSN func(values map[string]string) (string, error)
+}
+
+func (opts ConnectorOptions) validate() error {
+	if (opts.DriverName == "") == (opts.Driver == nil) {
+		return fmt.Errorf("%w: exactly one of DriverName and Driver is required", ErrInvalidConnectorOptions)
+	}
+
+	if (opts.DSNKey == "") == (opts.BuildDSN == nil) {
+		return fmt.Errorf("%w: exactly one of DSNKey and BuildDSN is required", ErrInvalidConnectorOptions)
+	}
+
+	if opts.DSNKey != "" && (len(opts.Keys) > 0 || opts.DatabaseRole != "") {
+		return fmt.Errorf("%w: Keys and DatabaseRole work only with BuildDSN", ErrInvalidConnectorOptions)
+	}
+
+	return nil
+}
+
+// RotatingConnector - driver.Connector, который берет DSN из менеджера на каждое новое соединение.
+// После смены кредов в vault'e новые соединения открываются уже с ними, а старые не рвутся:
+// занятые спокойно доделывают работу, а при возврате в пул (driver.Validator) или при выдаче из пула
+// (driver.SessionResetter) database/sql закрывает те, что открыты со старым DSN. Пересоздавать *sql.DB по уведомлениям не нужно
+type RotatingConnector struct {
+	sm     *SecretManagerVault
+	opts   ConnectorOptions
+	driver driver.Driver
+
+	mu        sync.Mutex
+	dsn       string
+	connector driver.Connector
+}
+
+// NewConnector собирает RotatingConnector поверх менеджера. Для *sql.DB удобнее OpenDB
+func (sm *SecretManagerVault) NewConnector(opts ConnectorOptions) (*RotatingConnector, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	// драйвер по имени достается только через sql.Open, а он у драйверов с driver.DriverContext разбирает DSN.
+	// Пустой DSN многие не принимают, поэтому здесь только проверяем имя, а сам драйвер берем с первым настоящим DSN
+	if opts.DriverName != "" && !slices.Contains(sql.Drivers(), opts.DriverName) {
+		return nil, fmt.Errorf("%w: unknown driver %q", ErrInvalidConnectorOptions, opts.DriverName)
+	}
+
+	return &RotatingConnector{sm: sm, opts: opts, driver: opts.Driver}, nil
+}
+
+// OpenDB - *sql.DB поверх RotatingConnector
+func (sm *SecretManagerVault) OpenDB(opts ConnectorOptions) (*sql.DB, error) {
+	connector, err := sm.NewConnector(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+func (c *RotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.currentDSN(ctx)
+	if err != nil {
+		c.sm.logger.Error("Error building dsn for new connection", "error", err)
+		return nil, err
+	}
+
+	connector, err := c.connectorFor(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotatingConn{Conn: conn, dsn: dsn, connector: c}, nil
+}
+
+// Driver - драйвер из опций. Если драйвер задан именем и соединений еще не было, отдается обертка,
+// которая достанет настоящий драйвер с первым DSN
+func (c *RotatingConnector) Driver() driver.Driver {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.driver == nil {
+		return namedDriver{connector: c}
+	}
+
+	return c.driver
+}
+
+// resolveDriverLocked находит драйвер по имени через sql.Open с настоящим DSN. Соединений sql.Open не открывает,
+// а коннектор, который он мог собрать, закрывается вместе с временным *sql.DB
+func (c *RotatingConnector) resolveDriverLocked(dsn string) (driver.Driver, error) {
+	if c.driver != nil {
+		return c.driver, nil
+	}
+
+	db, err := sql.Open(c.opts.DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.driver = db.Driver()
+	_ = db.Close()
+
+	return c.driver, nil
+}
+
+// namedDriver - драйвер, заданный именем, пока RotatingConnector его еще не достал
+type namedDriver struct {
+	connector *RotatingConnector
+}
+
+func (d namedDriver) Open(dsn string) (driver.Conn, error) {
+	d.connector.mu.Lock()
+	drv, err := d.connector.resolveDriverLocked(dsn)
+	d.connector.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return drv.Open(dsn)
+}
+
+// Close закрывает текущий коннектор драйвера, если он это умеет. Вызывается из (*sql.DB).Close
+func (c *RotatingConnector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if closer, ok := c.connector.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// connectorFor отдает коннектор драйвера под DSN, пересоздавая его, только когда DSN поменялся.
+// Замененный коннектор закрывается, если он io.Closer: уже открытые соединения от этого не рвутся,
+// они живут сами по себе и отбраковываются пулом, как обычно
+func (c *RotatingConnector) connectorFor(dsn string) (driver.Connector, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connector != nil && c.dsn == dsn {
+		return c.connector, nil
+	}
+
+	drv, err := c.resolveDriverLocked(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: drv}
+	if driverCtx, ok := drv.(driver.DriverContext); ok {
+		if connector, err = driverCtx.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.connector != nil {
+		c.sm.logger.Info("Database credentials changed, new connections will use them")
+		if closer, ok := c.connector.(io.Closer); ok {
+			if err = closer.Close(); err != nil {
+				c.sm.logger.Warn("Error closing replaced database connector", "error", err)
+			}
+		}
+	}
+	c.connector, c.dsn = connector, dsn
+
+	return connector, nil
+}
+
+func (c *RotatingConnector) currentDSN(ctx context.Context) (string, error) {
+	if c.opts.DSNKey != "" {
+		return c.sm.GetString(c.opts.DSNKey)
+	}
+
+	values := make(map[string]string, len(c.opts.Keys)+2)
+	for _, key := range c.opts.Keys {
+		value, err := c.sm.GetString(key)
+		if err != nil {
+			return "", fmt.Errorf("reading %q for dsn: %w", key, err)
+		}
+		values[key] = value
+	}
+
+	if c.opts.DatabaseRole != "" {
+		creds, err := c.sm.DatabaseCredentials(ctx, c.opts.DatabaseRole)
+		if err != nil {
+			return "", err
+		}
+		values["username"] = creds.Username
+		values["password"] = creds.Password
+	}
+
+	return c.opts.BuildDSN(values)
+}
+
+// isCurrent - соединение открыто с тем DSN, который менеджер отдал бы сейчас.
+// Если DSN собрать не вышло, соединение не трогаем: лучше старое рабочее, чем никакого
+func (c *RotatingConnector) isCurrent(dsn string) bool {
+	current, err := c.currentDSN(context.Background())
+	if err != nil {
+		return true
+	}
+
+	return current == dsn
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// rotatingConn - соединение драйвера, которое помнит, с каким DSN его открыли. Необязательные интерфейсы
+// драйвера пробрасываются, а если драйвер их не умеет, отдается то, что database/sql понимает как "делай по-старому"
+type rotatingConn struct {
+	driver.Conn
+	dsn       string
+	connector *RotatingConnector
+}
+
+var (
+	_ driver.Validator          = (*rotatingConn)(nil)
+	_ driver.SessionResetter    = (*rotatingConn)(nil)
+	_ driver.Pinger             = (*rotatingConn)(nil)
+	_ driver.ExecerContext      = (*rotatingConn)(nil)
+	_ driver.QueryerContext     = (*rotatingConn)(nil)
+	_ driver.ConnPrepareContext = (*rotatingConn)(nil)
+	_ driver.ConnBeginTx        = (*rotatingConn)(nil)
+	_ driver.NamedValueChecker  = (*rotatingConn)(nil)
+)
+
+func (c *rotatingConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok && !validator.IsValid() {
+		return false
+	}
+
+	return c.connector.isCurrent(c.dsn)
+}
+
+// ResetSession database/sql зовет, когда достает соединение из пула. Простаивавшее со старыми кредами
+// отбраковывается здесь через driver.ErrBadConn, и database/sql молча берет или открывает другое
+func (c *rotatingConn) ResetSession(ctx context.Context) error {
+	if !c.connector.isCurrent(c.dsn) {
+		return driver.ErrBadConn
+	}
+
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *rotatingConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *rotatingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+
+	return c.Conn.Prepare(query)
+}
+
+func (c *rotatingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	if opts.ReadOnly || opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, ErrTxOptionsNotSupported
+	}
+
+	// фолбэк для драйверов без ConnBeginTx, database/sql делает так же
+	return c.Conn.Begin()
+}
+
+func (c *rotatingConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	return driver.ErrSkip
+}
@@ -0,0 +1,248 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSQLDriver запоминает, с какими DSN открывались соединения и какие из них закрыли
+type fakeSQLDriver struct {
+	mu     sync.Mutex
+	opened []string
+	closed []string
+}
+
+type fakeSQLConn struct {
+	dsn    string
+	driver *fakeSQLDriver
+}
+
+func (d *fakeSQLDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.opened = append(d.opened, dsn)
+	return &fakeSQLConn{dsn: dsn, driver: d}, nil
+}
+
+func (d *fakeSQLDriver) snapshot() ([]string, []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.opened...), append([]string(nil), d.closed...)
+}
+
+func (c *fakeSQLConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeSQLConn) Close() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.closed = append(c.driver.closed, c.dsn)
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+var fakeSQLDriverSeq atomic.Int64
+
+// registerFakeSQLDriver регистрирует драйвер под новым именем: снять регистрацию в database/sql нельзя,
+// а тест может идти несколько раз подряд с -count
+func registerFakeSQLDriver(d driver.Driver) string {
+	name := fmt.Sprintf("vault-config-manager-fake-%d", fakeSQLDriverSeq.Add(1))
+	sql.Register(name, d)
+	return name
+}
+
+var connectorOptionsTests = []struct {
+	name string
+	opts ConnectorOptions
+}{
+	{"no driver", ConnectorOptions{DSNKey: "dsn"}},
+	{"both drivers", ConnectorOptions{DriverName: "x", Driver: &fakeSQLDriver{}, DSNKey: "dsn"}},
+	{"no dsn", ConnectorOptions{Driver: &fakeSQLDriver{}}},
+	{"keys with dsn key", ConnectorOptions{Driver: &fakeSQLDriver{}, DSNKey: "dsn", Keys: []string{"db_user"}}},
+	{"unknown driver", ConnectorOptions{DriverName: "no-such-driver", DSNKey: "dsn"}},
+}
+
+func TestConnectorOptionsValidation(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	for _, test := range connectorOptionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := sm.NewConnector(test.opts)
+			assert.True(t, errors.Is(err, ErrInvalidConnectorOptions))
+		})
+	}
+}
+
+func TestRotatingConnector(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	fakeDriver := &fakeSQLDriver{}
+	db, err := sm.OpenDB(ConnectorOptions{
+		DriverName: registerFakeSQLDriver(fakeDriver),
+		Keys:       []string{"db_user", "db_password"},
+		BuildDSN: func(values map[string]string) (string, error) {
+			return fmt.Sprintf("%s:%s@localhost/app", values["db_user"], values["db_password"]), nil
+		},
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	// держим соединение, как долгий запрос
+	busy, err := db.Conn(ctx)
+	require.NoError(t, err)
+
+	_, err = sm.PutSecret(ctx, "db", map[string]any{"db_user": "app", "db_password": "new"}, UpdateLocalConfig())
+	require.NoError(t, err)
+
+	// новое соединение - уже с новым паролем, старое при этом никто не закрыл
+	fresh, err := db.Conn(ctx)
+	require.NoError(t, err)
+
+	opened, closed := fakeDriver.snapshot()
+	assert.Equal(t, []string{"app:old@localhost/app", "app:new@localhost/app"}, opened)
+	assert.Empty(t, closed)
+
+	// старое вернулось в пул и отбраковано, новое остается жить
+	require.NoError(t, busy.Close())
+	require.NoError(t, fresh.Close())
+
+	_, closed = fakeDriver.snapshot()
+	assert.Equal(t, []string{"app:old@localhost/app"}, closed)
+
+	require.NoError(t, db.PingContext(ctx))
+	opened, _ = fakeDriver.snapshot()
+	assert.Len(t, opened, 2, "idle connection with current credentials should be reused")
+}
+
+func TestRotatingConnectorWithDatabaseRole(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.enableDatabase("database", "app", 60, 100)
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	fakeDriver := &fakeSQLDriver{}
+	db, err := sm.OpenDB(ConnectorOptions{
+		Driver:       fakeDriver,
+		DatabaseRole: "app",
+		BuildDSN: func(values map[string]string) (string, error) {
+			return values["username"] + ":" + values["password"], nil
+		},
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	require.NoError(t, db.PingContext(ctx))
+
+	creds, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+
+	// второе продление упирается в max TTL, креды меняются
+	sm.renewLeases(ctx, creds.IssuedAt.Add(40*time.Second))
+	sm.renewLeases(ctx, creds.IssuedAt.Add(80*time.Second))
+	require.NoError(t, db.PingContext(ctx))
+
+	opened, closed := fakeDriver.snapshot()
+	assert.Equal(t, []string{"v-app-1:password-1", "v-app-2:password-2"}, opened)
+	assert.Equal(t, []string{"v-app-1:password-1"}, closed)
+}
+
+// fakeSQLContextDriver - драйвер с driver.DriverContext, который, как многие настоящие, не принимает пустой DSN
+type fakeSQLContextDriver struct {
+	*fakeSQLDriver
+	connectors []*fakeSQLConnector
+}
+
+type fakeSQLConnector struct {
+	dsn    string
+	driver *fakeSQLContextDriver
+	closed bool
+}
+
+func (d *fakeSQLContextDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	if dsn == "" {
+		return nil, errors.New("empty dsn")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	connector := &fakeSQLConnector{dsn: dsn, driver: d}
+	d.connectors = append(d.connectors, connector)
+	return connector, nil
+}
+
+func (c *fakeSQLConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *fakeSQLConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *fakeSQLConnector) Close() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.closed = true
+	return nil
+}
+
+func TestRotatingConnectorDriverContext(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	fakeDriver := &fakeSQLContextDriver{fakeSQLDriver: &fakeSQLDriver{}}
+	db, err := sm.OpenDB(ConnectorOptions{
+		DriverName: registerFakeSQLDriver(fakeDriver),
+		Keys:       []string{"db_user", "db_password"},
+		BuildDSN: func(values map[string]string) (string, error) {
+			return fmt.Sprintf("%s:%s@localhost/app", values["db_user"], values["db_password"]), nil
+		},
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.PingContext(ctx))
+
+	_, err = sm.PutSecret(ctx, "db", map[string]any{"db_user": "app", "db_password": "new"}, UpdateLocalConfig())
+	require.NoError(t, err)
+
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	opened, _ := fakeDriver.snapshot()
+	assert.Equal(t, []string{"app:old@localhost/app", "app:new@localhost/app"}, opened)
+
+	// закрыты все коннекторы, кроме текущего: и временный от поиска драйвера, и со старым паролем
+	fakeDriver.mu.Lock()
+	defer fakeDriver.mu.Unlock()
+	require.NotEmpty(t, fakeDriver.connectors)
+	last := len(fakeDriver.connectors) - 1
+	for _, connector := range fakeDriver.connectors[:last] {
+		assert.True(t, connector.closed, connector.dsn)
+	}
+	assert.False(t, fakeDriver.connectors[last].closed)
+	assert.Equal(t, "app:new@localhost/app", fakeDriver.connectors[last].dsn)
+}
@@ -0,0 +1,223 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrValueNotIntegral = errors.New("value is not integral")
+	ErrValueOutOfRange  = errors.New("value is out of range")
+	ErrInvalidSyntax    = errors.New("string value has invalid syntax for the requested type")
+)
+
+// GetOption - настройка отдельного вызова геттера по пути (GetString, GetInt и т.д.), перекрывает настройки менеджера
+type GetOption func(*getOptions)
+
+type getOptions struct {
+	lenient bool
+}
+
+// Lenient - для этого вызова строки вроде "true", "8080" и "1.5" разбираются в запрошенный тип
+func Lenient() GetOption {
+	return func(o *getOptions) {
+		o.lenient = true
+	}
+}
+
+// Strict - для этого вызова тип значения должен совпадать с запрошенным, даже если менеджер в мягком режиме
+func Strict() GetOption {
+	return func(o *getOptions) {
+		o.lenient = false
+	}
+}
+
+func buildGetOptions(lenientByDefault bool, opts []GetOption) getOptions {
+	o := getOptions{lenient: lenientByDefault}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// decimalNumber - десятичная запись числа, как в JSON, плюс необязательный знак "+". Дроби вида "4/2", hex и Inf,
+// которые понимают big.Rat и strconv.ParseFloat, сюда не проходят
+var decimalNumber = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// numberFromString в мягком режиме превращает строку в json.Number, чтобы дальше она шла тем же путем,
+// что и числа из vault'a. Синтаксис проверяется здесь, чтобы ошибка говорила, что именно не так
+func numberFromString(value any, lenient bool, baseErr error) (any, error) {
+	str, isString := value.(string)
+	if !isString || !lenient {
+		return value, nil
+	}
+
+	str = strings.TrimSpace(str)
+	if !decimalNumber.MatchString(str) {
+		return nil, fmt.Errorf("%w: %w: %q", baseErr, ErrInvalidSyntax, str)
+	}
+
+	return json.Number(str), nil
+}
+
+func toString(value any, lenient bool) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+
+	if !lenient {
+		return "", ErrWhileConvertingToString
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	default:
+		return "", ErrWhileConvertingToString
+	}
+}
+
+func toBool(value any, lenient bool) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if !lenient {
+			return false, ErrWhileConvertingToBool
+		}
+
+		boolVal, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("%w: %w: %q", ErrWhileConvertingToBool, ErrInvalidSyntax, v)
+		}
+		return boolVal, nil
+	default:
+		return false, ErrWhileConvertingToBool
+	}
+}
+
+// toBigRat переводит числовое значение из конфига в big.Rat, чтобы дальше проверять целочисленность и диапазон
+// без промежуточного float64, который портит всё, что больше 2^53
+func toBigRat(value any) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(v), true
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), true
+	default:
+		return nil, false
+	}
+}
+
+// toInt64 - приведение без потерь: 3.7 и 9223372036854775808 вернут ошибку, а не обрезанное значение
+func toInt64(value any, lenient bool, baseErr error) (int64, error) {
+	value, err := numberFromString(value, lenient, baseErr)
+	if err != nil {
+		return 0, err
+	}
+
+	rat, ok := toBigRat(value)
+	if !ok {
+		return 0, baseErr
+	}
+
+	if !rat.IsInt() {
+		return 0, fmt.Errorf("%w: %w", baseErr, ErrValueNotIntegral)
+	}
+
+	if !rat.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %w", baseErr, ErrValueOutOfRange)
+	}
+
+	return rat.Num().Int64(), nil
+}
+
+func toUint64(value any, lenient bool, baseErr error) (uint64, error) {
+	value, err := numberFromString(value, lenient, baseErr)
+	if err != nil {
+		return 0, err
+	}
+
+	rat, ok := toBigRat(value)
+	if !ok {
+		return 0, baseErr
+	}
+
+	if !rat.IsInt() {
+		return 0, fmt.Errorf("%w: %w", baseErr, ErrValueNotIntegral)
+	}
+
+	if !rat.Num().IsUint64() {
+		return 0, fmt.Errorf("%w: %w", baseErr, ErrValueOutOfRange)
+	}
+
+	return rat.Num().Uint64(), nil
+}
+
+func toInt(value any, lenient bool) (int, error) {
+	intVal, err := toInt64(value, lenient, ErrWhileConvertingToInt)
+	if err != nil {
+		return 0, err
+	}
+
+	if intVal < math.MinInt || intVal > math.MaxInt {
+		return 0, fmt.Errorf("%w: %w", ErrWhileConvertingToInt, ErrValueOutOfRange)
+	}
+
+	return int(intVal), nil
+}
+
+func toFloat64(value any, lenient bool) (float64, error) {
+	value, err := numberFromString(value, lenient, ErrWhileConvertingToFloat)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		floatVal, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return 0, fmt.Errorf("%w: %w", ErrWhileConvertingToFloat, ErrValueOutOfRange)
+			}
+			return 0, ErrWhileConvertingToFloat
+		}
+		return floatVal, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	default:
+		return 0, ErrWhileConvertingToFloat
+	}
+}
@@ -0,0 +1,331 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	// DefaultDatabaseMount - маунт database secrets engine по умолчанию
+	DefaultDatabaseMount = "database"
+	// DefaultLeaseCheckInterval - как часто StartLeaseRenewer смотрит на сроки аренд
+	DefaultLeaseCheckInterval = 10 * time.Second
+	// leaseRenewFraction - какая доля аренды должна пройти, прежде чем ее продлевать, как у vault agent
+	leaseRenewFraction = 2.0 / 3.0
+)
+
+var (
+	ErrNoDatabaseCredentials = errors.New("database credentials response has no username or password")
+	ErrLeaseMaxTTLReached    = errors.New("lease renewal was capped by max ttl")
+)
+
+// DatabaseCredentials - динамические креды из database/creds/<role> вместе с арендой.
+// Пароль никогда не логируется
+type DatabaseCredentials struct {
+	Role     string
+	Username string
+	Password string
+
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
+}
+
+// DatabaseLease - состояние аренды для Status, без пароля
+type DatabaseLease struct {
+	Role      string
+	Username  string
+	LeaseID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Renewable bool
+	Renewals  int
+}
+
+// LeaseRenewerOptions - настройки StartLeaseRenewer
+type LeaseRenewerOptions struct {
+	// Interval - как часто проверять аренды, по умолчанию DefaultLeaseCheckInterval.
+	// Должен быть заметно меньше TTL ролей, иначе продлевать будет поздно
+	Interval time.Duration
+}
+
+type databaseLease struct {
+	creds         DatabaseCredentials
+	lastRenewedAt time.Time
+	renewals      int
+	subscribers   []chan DatabaseCredentials
+}
+
+// issued - креды уже выписаны. Подписка до первого DatabaseCredentials заводит роль без кредов
+func (l *databaseLease) issued() bool {
+	return l.creds.Username != ""
+}
+
+type databaseLeases struct {
+	sync.Mutex
+	mount  string
+	leases map[string]*databaseLease
+}
+
+// DatabaseCredentials отдает текущие креды роли. При первом обращении креды запрашиваются у vault'a,
+// дальше роль отслеживается: StartLeaseRenewer продлевает аренду и выписывает новые креды, когда продлевать больше нельзя
+func (sm *SecretManagerVault) DatabaseCredentials(ctx context.Context, role string) (DatabaseCredentials, error) {
+	sm.dbLeases.Lock()
+	lease, exists := sm.dbLeases.leases[role]
+	sm.dbLeases.Unlock()
+
+	if exists && lease.issued() {
+		return lease.creds, nil
+	}
+
+	creds, err := sm.issueDatabaseCredentials(ctx, role)
+	if err != nil {
+		return DatabaseCredentials{}, err
+	}
+
+	sm.dbLeases.Lock()
+	defer sm.dbLeases.Unlock()
+
+	lease, exists = sm.dbLeases.leases[role]
+	if !exists {
+		lease = &databaseLease{}
+		sm.dbLeases.leases[role] = lease
+	}
+	// пока ходили в vault, креды роли мог выписать кто-то еще - тогда наши лишние, отдаем уже отслеживаемые
+	if lease.issued() {
+		return lease.creds, nil
+	}
+	lease.creds = creds
+	lease.lastRenewedAt = creds.IssuedAt
+
+	sm.logger.Info("Database credentials issued", "role", role, "username", creds.Username, "lease_id", creds.LeaseID, "ttl", creds.LeaseDuration)
+
+	return creds, nil
+}
+
+// SubscribeDatabaseCredentials - канал, в который приходят новые креды роли после каждой ротации.
+// Буфер на одно значение: если подписчик не успел забрать прошлые креды, они заменяются свежими.
+// Роль начинает отслеживаться, только после DatabaseCredentials. Канал не закрывается
+func (sm *SecretManagerVault) SubscribeDatabaseCredentials(role string) <-chan DatabaseCredentials {
+	ch := make(chan DatabaseCredentials, 1)
+
+	sm.dbLeases.Lock()
+	defer sm.dbLeases.Unlock()
+
+	lease, exists := sm.dbLeases.leases[role]
+	if !exists {
+		lease = &databaseLease{}
+		sm.dbLeases.leases[role] = lease
+	}
+	lease.subscribers = append(lease.subscribers, ch)
+
+	return ch
+}
+
+// StartLeaseRenewer блокирующе следит за арендами динамических кредов, запускать в отдельной горутине.
+// Аренда продлевается, когда прошло 2/3 ее срока. Если vault продлил меньше, чем просили (упираемся в max TTL),
+// или продлить не вышло, выписываются новые креды и рассылаются подписчикам. Старые креды не отзываются:
+// они доживают свой срок, чтобы пулы соединений успели переехать. Останавливается через StopUpdater
+func (sm *SecretManagerVault) StartLeaseRenewer(opts LeaseRenewerOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultLeaseCheckInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sm.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.stopChan:
+			return
+		case <-ticker.C:
+			sm.renewLeases(ctx, time.Now())
+		}
+	}
+}
+
+// DatabaseLeases - отслеживаемые аренды по ролям
+func (sm *SecretManagerVault) DatabaseLeases() []DatabaseLease {
+	sm.dbLeases.Lock()
+	defer sm.dbLeases.Unlock()
+
+	leases := make([]DatabaseLease, 0, len(sm.dbLeases.leases))
+	for _, lease := range sm.dbLeases.leases {
+		if lease.creds.LeaseID == "" {
+			continue
+		}
+		leases = append(leases, DatabaseLease{
+			Role:      lease.creds.Role,
+			Username:  lease.creds.Username,
+			LeaseID:   lease.creds.LeaseID,
+			IssuedAt:  lease.creds.IssuedAt,
+			ExpiresAt: lease.creds.ExpiresAt,
+			Renewable: lease.creds.Renewable,
+			Renewals:  lease.renewals,
+		})
+	}
+
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].Role < leases[j].Role
+	})
+
+	return leases
+}
+
+// renewLeases - один проход продления по состоянию на now
+func (sm *SecretManagerVault) renewLeases(ctx context.Context, now time.Time) {
+	sm.dbLeases.Lock()
+	due := make(map[string]DatabaseCredentials)
+	for role, lease := range sm.dbLeases.leases {
+		// аренда без TTL не истекает: продлевать нечего, а иначе она была бы "к сроку" на каждом проходе
+		if !lease.issued() || lease.creds.LeaseID == "" || lease.creds.LeaseDuration <= 0 {
+			continue
+		}
+		renewAt := lease.lastRenewedAt.Add(time.Duration(float64(lease.creds.LeaseDuration) * leaseRenewFraction))
+		if !now.Before(renewAt) {
+			due[role] = lease.creds
+		}
+	}
+	sm.dbLeases.Unlock()
+
+	for role, creds := range due {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if creds.Renewable {
+			err := sm.renewDatabaseLease(ctx, creds, now)
+			if err == nil {
+				continue
+			}
+			sm.logger.Info("Lease can not be renewed, rotating credentials", "role", role, "lease_id", creds.LeaseID, "error", err)
+		}
+
+		if err := sm.rotateDatabaseCredentials(ctx, role); err != nil {
+			sm.logger.Error("Error rotating database credentials", "role", role, "error", err)
+		}
+	}
+}
+
+// renewDatabaseLease продлевает аренду на ее исходный срок. ErrLeaseMaxTTLReached - vault продлил меньше,
+// чем просили, то есть аренда уперлась в max TTL и скоро кончится в любом случае
+func (sm *SecretManagerVault) renewDatabaseLease(ctx context.Context, creds DatabaseCredentials, now time.Time) error {
+	increment := int(creds.LeaseDuration.Seconds())
+
+	resp, err := sm.vaultClient.Sys().RenewWithContext(ctx, creds.LeaseID, increment)
+	if err != nil {
+		return err
+	}
+
+	if resp == nil {
+		return ErrEmptyVaultResponse
+	}
+
+	granted := time.Duration(resp.LeaseDuration) * time.Second
+
+	sm.dbLeases.Lock()
+	if lease, exists := sm.dbLeases.leases[creds.Role]; exists && lease.creds.LeaseID == creds.LeaseID {
+		lease.creds.ExpiresAt = now.Add(granted)
+		lease.lastRenewedAt = now
+		lease.renewals++
+	}
+	sm.dbLeases.Unlock()
+
+	if granted < creds.LeaseDuration {
+		return fmt.Errorf("%w: granted %s of %s", ErrLeaseMaxTTLReached, granted, creds.LeaseDuration)
+	}
+
+	sm.logger.Debug("Lease renewed", "role", creds.Role, "lease_id", creds.LeaseID, "ttl", granted)
+
+	return nil
+}
+
+// rotateDatabaseCredentials выписывает новые креды роли и рассылает их подписчикам
+func (sm *SecretManagerVault) rotateDatabaseCredentials(ctx context.Context, role string) error {
+	creds, err := sm.issueDatabaseCredentials(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	sm.dbLeases.Lock()
+	defer sm.dbLeases.Unlock()
+
+	lease, exists := sm.dbLeases.leases[role]
+	if !exists {
+		lease = &databaseLease{}
+		sm.dbLeases.leases[role] = lease
+	}
+	previousLeaseID := lease.creds.LeaseID
+	lease.creds = creds
+	lease.lastRenewedAt = creds.IssuedAt
+	lease.renewals = 0
+
+	for _, subscriber := range lease.subscribers {
+		select {
+		case <-subscriber: // подписчик не забрал прошлые креды, они уже не нужны
+		default:
+		}
+		subscriber <- creds
+	}
+
+	sm.logger.Info("Database credentials rotated",
+		"role", role, "username", creds.Username, "lease_id", creds.LeaseID, "previous_lease_id", previousLeaseID)
+
+	return nil
+}
+
+func (sm *SecretManagerVault) issueDatabaseCredentials(ctx context.Context, role string) (DatabaseCredentials, error) {
+	path := sm.dbLeases.mount + "creds/" + strings.Trim(role, "/")
+
+	resp, err := sm.vaultClient.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		sm.logger.Error("Error requesting database credentials", "role", role, "error", err)
+		return DatabaseCredentials{}, err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return DatabaseCredentials{}, ErrEmptyVaultResponse
+	}
+
+	return databaseCredentialsFromSecret(role, resp, time.Now())
+}
+
+func databaseCredentialsFromSecret(role string, resp *vaultapi.Secret, issuedAt time.Time) (DatabaseCredentials, error) {
+	username, _ := resp.Data["username"].(string)
+	password, _ := resp.Data["password"].(string)
+	if username == "" || password == "" {
+		return DatabaseCredentials{}, fmt.Errorf("%w: role %q", ErrNoDatabaseCredentials, role)
+	}
+
+	leaseDuration := time.Duration(resp.LeaseDuration) * time.Second
+
+	return DatabaseCredentials{
+		Role:          role,
+		Username:      username,
+		Password:      password,
+		LeaseID:       resp.LeaseID,
+		LeaseDuration: leaseDuration,
+		Renewable:     resp.Renewable,
+		IssuedAt:      issuedAt,
+		ExpiresAt:     issuedAt.Add(leaseDuration),
+	}, nil
+}
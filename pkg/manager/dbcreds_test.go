@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDatabase - database secrets engine фейкового vault'a: каждая аренда живет ttl и продлевается не дальше maxTTL
+type fakeDatabase struct {
+	mu      sync.Mutex
+	ttl     int
+	maxTTL  int
+	issued  int
+	renews  int
+	expires map[string]int // lease_id -> сколько секунд аренде осталось до max TTL
+}
+
+func (fv *fakeVault) enableDatabase(mount, role string, ttl, maxTTL int) *fakeDatabase {
+	db := &fakeDatabase{ttl: ttl, maxTTL: maxTTL, expires: make(map[string]int)}
+
+	fv.handle(mount+"/creds/"+role, func(r *fakeRequest) any {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		db.issued++
+		leaseID := fmt.Sprintf("%s/creds/%s/lease-%d", mount, role, db.issued)
+		db.expires[leaseID] = db.maxTTL
+
+		return map[string]any{
+			"lease_id":       leaseID,
+			"lease_duration": db.ttl,
+			"renewable":      true,
+			"data": map[string]any{
+				"username": fmt.Sprintf("v-%s-%d", role, db.issued),
+				"password": fmt.Sprintf("password-%d", db.issued),
+			},
+		}
+	})
+
+	fv.handle("sys/leases/renew", func(r *fakeRequest) any {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		leaseID, _ := r.body["lease_id"].(string)
+		left, exists := db.expires[leaseID]
+		if !exists {
+			return &fakeVaultError{code: http.StatusBadRequest, messages: []string{"lease not found"}}
+		}
+
+		increment, _ := r.body["increment"].(json.Number).Int64()
+		granted := min(int(increment), left)
+		db.expires[leaseID] = left - granted
+		db.renews++
+
+		return map[string]any{"lease_id": leaseID, "lease_duration": granted, "renewable": true}
+	})
+
+	return db
+}
+
+func TestDatabaseCredentialsLeases(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	db := fv.enableDatabase("db-engine", "app", 60, 150)
+
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithDatabaseMount("db-engine"),
+	)
+	require.NoError(t, err)
+
+	updates := sm.SubscribeDatabaseCredentials("app")
+	ctx := context.Background()
+
+	creds, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "v-app-1", creds.Username)
+	assert.Equal(t, "password-1", creds.Password)
+	assert.Equal(t, time.Minute, creds.LeaseDuration)
+
+	again, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, creds.LeaseID, again.LeaseID)
+
+	issuedAt := creds.IssuedAt
+
+	// до 2/3 срока ничего не делаем
+	sm.renewLeases(ctx, issuedAt.Add(30*time.Second))
+	assert.Equal(t, 0, db.renews)
+
+	// продление на полный срок: 150-60 = 90 секунд до max TTL осталось
+	sm.renewLeases(ctx, issuedAt.Add(40*time.Second))
+	assert.Equal(t, 1, db.renews)
+	leases := sm.Status().DatabaseLeases
+	require.Len(t, leases, 1)
+	assert.Equal(t, 1, leases[0].Renewals)
+	assert.Equal(t, issuedAt.Add(100*time.Second), leases[0].ExpiresAt)
+
+	// еще одно продление на полный срок, до max TTL осталось 30 секунд
+	sm.renewLeases(ctx, issuedAt.Add(80*time.Second))
+	assert.Equal(t, 2, db.renews)
+	select {
+	case <-updates:
+		t.Fatal("credentials must not rotate while the lease can be extended")
+	default:
+	}
+
+	// vault продлил меньше, чем просили - упираемся в max TTL, выписываем новые креды
+	sm.renewLeases(ctx, issuedAt.Add(120*time.Second))
+	assert.Equal(t, 3, db.renews)
+
+	select {
+	case rotated := <-updates:
+		assert.Equal(t, "v-app-2", rotated.Username)
+		assert.NotEqual(t, creds.LeaseID, rotated.LeaseID)
+	default:
+		t.Fatal("expected rotated credentials")
+	}
+
+	current, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "v-app-2", current.Username)
+	assert.Equal(t, 0, sm.DatabaseLeases()[0].Renewals)
+}
+
+func TestDatabaseCredentialsRenewFailureRotates(t *testing.T) {
+	fv := newFakeVault(t)
+	db := fv.enableDatabase("database", "app", 60, 600)
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	creds, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+
+	// vault забыл аренду, например после рестарта без storage
+	db.mu.Lock()
+	delete(db.expires, creds.LeaseID)
+	db.mu.Unlock()
+
+	updates := sm.SubscribeDatabaseCredentials("app")
+	sm.renewLeases(ctx, creds.IssuedAt.Add(time.Minute))
+
+	rotated := <-updates
+	assert.Equal(t, "v-app-2", rotated.Username)
+}
+
+func TestDatabaseCredentialsWithoutTTL(t *testing.T) {
+	fv := newFakeVault(t)
+	db := fv.enableDatabase("database", "app", 0, 0)
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	creds, err := sm.DatabaseCredentials(ctx, "app")
+	require.NoError(t, err)
+	assert.Zero(t, creds.LeaseDuration)
+
+	updates := sm.SubscribeDatabaseCredentials("app")
+	for i := range 3 {
+		sm.renewLeases(ctx, creds.IssuedAt.Add(time.Duration(i)*time.Hour))
+	}
+
+	// ни продлений, ни новых кредов
+	assert.Equal(t, 0, db.renews)
+	assert.Equal(t, 1, db.issued)
+	select {
+	case <-updates:
+		t.Fatal("credentials without ttl must not rotate")
+	default:
+	}
+}
+
+func TestLeaseRenewerStops(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableDatabase("database", "app", 60, 600)
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		sm.StartLeaseRenewer(LeaseRenewerOptions{Interval: time.Millisecond})
+		close(done)
+	}()
+
+	_, err = sm.DatabaseCredentials(context.Background(), "app")
+	require.NoError(t, err)
+
+	require.NoError(t, sm.StopUpdater())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lease renewer did not stop")
+	}
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"reflect"
+	"sort"
+)
+
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota + 1
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyChange - изменение одного ключа между двумя наборами секретов. Old пустой для добавленных ключей, New - для удаленных
+type KeyChange struct {
+	Key  string
+	Kind ChangeKind
+	Old  any
+	New  any
+}
+
+// DiffConfigs сравнивает два набора пар ключ-значение и возвращает изменения от from к to, отсортированные по ключу
+func DiffConfigs(from, to map[string]any) []KeyChange {
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, exists := from[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []KeyChange
+	for _, k := range keys {
+		oldValue, inFrom := from[k]
+		newValue, inTo := to[k]
+
+		switch {
+		case !inFrom:
+			changes = append(changes, KeyChange{Key: k, Kind: ChangeAdded, New: newValue})
+		case !inTo:
+			changes = append(changes, KeyChange{Key: k, Kind: ChangeRemoved, Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, KeyChange{Key: k, Kind: ChangeModified, Old: oldValue, New: newValue})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var diffConfigsTests = []struct {
+	name     string
+	from     map[string]any
+	to       map[string]any
+	expected []KeyChange
+}{
+	{"both empty", nil, nil, nil},
+	{"no changes", map[string]any{"a": "1"}, map[string]any{"a": "1"}, nil},
+	{
+		"added, removed and modified",
+		map[string]any{"a": "1", "b": json.Number("2"), "c": map[string]any{"x": "y"}},
+		map[string]any{"b": json.Number("3"), "c": map[string]any{"x": "y"}, "d": true},
+		[]KeyChange{
+			{Key: "a", Kind: ChangeRemoved, Old: "1"},
+			{Key: "b", Kind: ChangeModified, Old: json.Number("2"), New: json.Number("3")},
+			{Key: "d", Kind: ChangeAdded, New: true},
+		},
+	},
+	{
+		"nested change",
+		map[string]any{"c": map[string]any{"x": "y"}},
+		map[string]any{"c": map[string]any{"x": "z"}},
+		[]KeyChange{{Key: "c", Kind: ChangeModified, Old: map[string]any{"x": "y"}, New: map[string]any{"x": "z"}}},
+	},
+}
+
+func TestDiffConfigs(t *testing.T) {
+	for _, test := range diffConfigsTests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, DiffConfigs(test.from, test.to))
+		})
+	}
+}
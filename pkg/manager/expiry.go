@@ -0,0 +1,311 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	ErrMetadataNotSupported = errors.New("secret metadata is supported only on kv v2 mounts")
+	ErrInvalidExpiry        = errors.New("invalid expiry in custom metadata")
+)
+
+const (
+	// ExpiresAtMetadataKey - ключ custom_metadata с моментом истечения в RFC 3339, например 2026-01-31T00:00:00Z
+	ExpiresAtMetadataKey = "expires_at"
+	// MaxAgeMetadataKey - ключ custom_metadata с максимальным возрастом секрета от updated_time: 90d, 2160h, 30m
+	MaxAgeMetadataKey = "max_age"
+
+	// DefaultExpiryWarning - за сколько до истечения секрет считается истекающим
+	DefaultExpiryWarning = 7 * 24 * time.Hour
+)
+
+// Метрики, которые отдает отслеживание истечения
+const (
+	MetricSecretExpiresIn = "vault_secret_expires_in_seconds" // по папке, отрицательное значение - уже истек
+	MetricSecretsExpiring = "vault_secrets_expiring"
+	MetricSecretsExpired  = "vault_secrets_expired"
+)
+
+type ExpiryState int
+
+const (
+	ExpiryOK ExpiryState = iota + 1
+	ExpiryWarning
+	ExpiryExpired
+	// ExpiryInvalid - в custom_metadata лежит что-то, что не получилось разобрать, Err содержит причину
+	ExpiryInvalid
+)
+
+func (s ExpiryState) String() string {
+	switch s {
+	case ExpiryOK:
+		return "ok"
+	case ExpiryWarning:
+		return "expiring"
+	case ExpiryExpired:
+		return "expired"
+	case ExpiryInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// SecretExpiry - срок жизни папки, размеченной через custom_metadata expires_at и/или max_age.
+// Если заданы оба, побеждает более ранний срок
+type SecretExpiry struct {
+	Folder      string
+	UpdatedTime time.Time
+	ExpiresAt   time.Time
+	State       ExpiryState
+	Err         error
+}
+
+// ExpiresIn - сколько осталось до истечения на момент now, отрицательное значение - секрет уже истек
+func (e SecretExpiry) ExpiresIn(now time.Time) time.Duration {
+	return e.ExpiresAt.Sub(now)
+}
+
+// SetExpiryTracking включает проверку сроков при каждом полном обновлении конфига: на каждую папку
+// уходит дополнительный запрос за метаданными. warnWithin - за сколько до истечения секрет считается истекающим,
+// 0 выключает отслеживание. Результат - в Status, SecretExpiries и метриках
+func (sm *SecretManagerVault) SetExpiryTracking(warnWithin time.Duration) {
+	sm.stateMu.Lock()
+	sm.expiryWarnWithin = warnWithin
+	var stale map[string]struct{}
+	if warnWithin <= 0 {
+		stale = sm.state.expiryGauges
+		sm.state.expiries = nil
+		sm.state.expiryCheckedAt = time.Time{}
+		sm.state.expiryGauges = nil
+	}
+	sm.stateMu.Unlock()
+
+	for folder := range stale {
+		deleteGauge(sm.metrics, MetricSecretExpiresIn, map[string]string{"folder": folder})
+	}
+}
+
+// SecretExpiries - сроки всех размеченных папок по результатам последнего полного обновления
+func (sm *SecretManagerVault) SecretExpiries() []SecretExpiry {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	return append([]SecretExpiry(nil), sm.state.expiries...)
+}
+
+// CheckExpiry обходит все папки прямо сейчас и возвращает сроки размеченных, отсортированные по ExpiresAt.
+// Работает независимо от SetExpiryTracking, warnWithin <= 0 - DefaultExpiryWarning. Конфиг не трогает
+func (sm *SecretManagerVault) CheckExpiry(ctx context.Context, warnWithin time.Duration) ([]SecretExpiry, error) {
+	if sm.kv.version == KVVersion1 {
+		return nil, ErrMetadataNotSupported
+	}
+
+	if warnWithin <= 0 {
+		warnWithin = DefaultExpiryWarning
+	}
+
+	expiries := make([]SecretExpiry, 0)
+	err := sm.walkSecretFolders(func(folder string) error {
+		metadata, err := sm.readSecretMetadata(ctx, folder)
+		if err != nil {
+			if errors.Is(err, ErrEmptyVaultResponse) {
+				return nil
+			}
+			return err
+		}
+
+		if expiry, tagged := folderExpiryFromMetadata(folder, metadata, time.Now(), warnWithin); tagged {
+			expiries = append(expiries, expiry)
+		}
+
+		return nil
+	})
+
+	sortExpiries(expiries)
+
+	return expiries, err
+}
+
+func (sm *SecretManagerVault) expiryTrackingEnabled() bool {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	return sm.expiryWarnWithin > 0 && sm.kv.version == KVVersion2
+}
+
+// readFolderExpiry - срок папки для отслеживания во время полного обновления. Ошибки только логируются:
+// из-за метаданных обновление конфига падать не должно
+func (sm *SecretManagerVault) readFolderExpiry(ctx context.Context, folder string) (SecretExpiry, bool) {
+	metadata, err := sm.readSecretMetadata(ctx, folder)
+	if err != nil {
+		if !errors.Is(err, ErrEmptyVaultResponse) {
+			sm.logger.Warn("Error reading secret metadata for expiry", "folder", folder, "error", err)
+		}
+		return SecretExpiry{}, false
+	}
+
+	sm.stateMu.Lock()
+	warnWithin := sm.expiryWarnWithin
+	sm.stateMu.Unlock()
+
+	return folderExpiryFromMetadata(folder, metadata, time.Now(), warnWithin)
+}
+
+// readSecretMetadata читает метаданные папки. Имена с "/" на конце бывают и просто каталогами, и секретами:
+// у каталога метаданных нет, это ErrEmptyVaultResponse, как и 404
+func (sm *SecretManagerVault) readSecretMetadata(ctx context.Context, folder string) (map[string]any, error) {
+	resp, err := sm.vaultClient.Logical().ReadWithContext(ctx, sm.baseMetaPath+folder)
+	if err != nil {
+		var respErr *vaultapi.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			return nil, ErrEmptyVaultResponse
+		}
+		return nil, err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	return resp.Data, nil
+}
+
+// recordExpiries запоминает результат проверки и выставляет метрики
+func (sm *SecretManagerVault) recordExpiries(expiries []SecretExpiry) {
+	sortExpiries(expiries)
+	now := time.Now()
+
+	gauged := make(map[string]struct{}, len(expiries))
+	expiring, expired := 0, 0
+	for _, expiry := range expiries {
+		switch expiry.State {
+		case ExpiryWarning:
+			expiring++
+			sm.logger.Warn("Secret is close to expiry", "folder", expiry.Folder, "expires_at", expiry.ExpiresAt)
+		case ExpiryExpired:
+			expired++
+			sm.logger.Warn("Secret is expired", "folder", expiry.Folder, "expires_at", expiry.ExpiresAt)
+		case ExpiryInvalid:
+			sm.logger.Warn("Invalid expiry in secret metadata", "folder", expiry.Folder, "error", expiry.Err)
+			continue
+		}
+
+		sm.metrics.SetGauge(MetricSecretExpiresIn, map[string]string{"folder": expiry.Folder}, expiry.ExpiresIn(now).Seconds())
+		gauged[expiry.Folder] = struct{}{}
+	}
+
+	sm.metrics.SetGauge(MetricSecretsExpiring, nil, float64(expiring))
+	sm.metrics.SetGauge(MetricSecretsExpired, nil, float64(expired))
+
+	sm.stateMu.Lock()
+	stale := sm.state.expiryGauges
+	sm.state.expiries = expiries
+	sm.state.expiryCheckedAt = now
+	sm.state.expiryGauges = gauged
+	sm.stateMu.Unlock()
+
+	// папки, с которых сняли разметку, удалили или сломали в них срок, не должны продолжать алертить старым значением
+	for folder := range stale {
+		if _, stillGauged := gauged[folder]; !stillGauged {
+			deleteGauge(sm.metrics, MetricSecretExpiresIn, map[string]string{"folder": folder})
+		}
+	}
+}
+
+// folderExpiryFromMetadata считает срок папки по ответу kv/metadata. false - папка не размечена
+func folderExpiryFromMetadata(folder string, metadata map[string]any, now time.Time, warnWithin time.Duration) (SecretExpiry, bool) {
+	custom, _ := metadata["custom_metadata"].(map[string]any)
+	rawExpiresAt, hasExpiresAt := custom[ExpiresAtMetadataKey].(string)
+	rawMaxAge, hasMaxAge := custom[MaxAgeMetadataKey].(string)
+
+	if !hasExpiresAt && !hasMaxAge {
+		return SecretExpiry{}, false
+	}
+
+	expiry := SecretExpiry{Folder: folder, UpdatedTime: parseVaultTime(metadata["updated_time"])}
+
+	if hasExpiresAt {
+		expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(rawExpiresAt))
+		if err != nil {
+			expiry.State, expiry.Err = ExpiryInvalid, fmt.Errorf("%w: %s %q: %w", ErrInvalidExpiry, ExpiresAtMetadataKey, rawExpiresAt, err)
+			return expiry, true
+		}
+		expiry.ExpiresAt = expiresAt
+	}
+
+	if hasMaxAge {
+		maxAge, err := parseMaxAge(rawMaxAge)
+		if err != nil {
+			expiry.State, expiry.Err = ExpiryInvalid, fmt.Errorf("%w: %s %q: %w", ErrInvalidExpiry, MaxAgeMetadataKey, rawMaxAge, err)
+			return expiry, true
+		}
+		if expiry.UpdatedTime.IsZero() {
+			expiry.State, expiry.Err = ExpiryInvalid, fmt.Errorf("%w: %s without updated_time", ErrInvalidExpiry, MaxAgeMetadataKey)
+			return expiry, true
+		}
+
+		byAge := expiry.UpdatedTime.Add(maxAge)
+		if expiry.ExpiresAt.IsZero() || byAge.Before(expiry.ExpiresAt) {
+			expiry.ExpiresAt = byAge
+		}
+	}
+
+	switch left := expiry.ExpiresIn(now); {
+	case left <= 0:
+		expiry.State = ExpiryExpired
+	case left <= warnWithin:
+		expiry.State = ExpiryWarning
+	default:
+		expiry.State = ExpiryOK
+	}
+
+	return expiry, true
+}
+
+// parseMaxAge понимает все, что понимает time.ParseDuration, плюс дни: "90d"
+func parseMaxAge(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+
+	var maxAge time.Duration
+	if days, found := strings.CutSuffix(raw, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		maxAge = time.Duration(count) * 24 * time.Hour
+	} else {
+		var err error
+		if maxAge, err = time.ParseDuration(raw); err != nil {
+			return 0, err
+		}
+	}
+
+	if maxAge <= 0 {
+		return 0, errors.New("max age must be positive")
+	}
+
+	return maxAge, nil
+}
+
+// sortExpiries - сначала невалидные (их надо чинить), дальше по сроку
+func sortExpiries(expiries []SecretExpiry) {
+	sort.SliceStable(expiries, func(i, j int) bool {
+		if (expiries[i].State == ExpiryInvalid) != (expiries[j].State == ExpiryInvalid) {
+			return expiries[i].State == ExpiryInvalid
+		}
+		if !expiries[i].ExpiresAt.Equal(expiries[j].ExpiresAt) {
+			return expiries[i].ExpiresAt.Before(expiries[j].ExpiresAt)
+		}
+		return expiries[i].Folder < expiries[j].Folder
+	})
+}
@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagSecret размечает секрет фейкового vault'a custom_metadata и сдвигает время последнего обновления
+func (fv *fakeVault) tagSecret(path string, custom map[string]any, updated time.Time) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	secret := fv.secrets[strings.Trim(path, "/")]
+	secret.customMetadata = custom
+	secret.latest().created = updated
+}
+
+type recordingMetrics struct {
+	mu     sync.Mutex
+	gauges map[string]float64
+}
+
+func (m *recordingMetrics) SetGauge(name string, labels map[string]string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if folder, ok := labels["folder"]; ok {
+		name += "/" + folder
+	}
+	m.gauges[name] = value
+}
+
+func (m *recordingMetrics) DeleteGauge(name string, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if folder, ok := labels["folder"]; ok {
+		name += "/" + folder
+	}
+	delete(m.gauges, name)
+}
+
+func (m *recordingMetrics) gauge(name string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.gauges[name]
+	return value, ok
+}
+
+var folderExpiryTests = []struct {
+	name          string
+	custom        map[string]any
+	updatedAgo    time.Duration
+	expectedState ExpiryState
+	tagged        bool
+}{
+	{"not tagged", map[string]any{"owner": "team"}, 0, 0, false},
+	{"max age ok", map[string]any{"max_age": "90d"}, 24 * time.Hour, ExpiryOK, true},
+	{"max age warning", map[string]any{"max_age": "90d"}, 85 * 24 * time.Hour, ExpiryWarning, true},
+	{"max age expired", map[string]any{"max_age": "2160h"}, 91 * 24 * time.Hour, ExpiryExpired, true},
+	{"expires at expired", map[string]any{"expires_at": "2020-01-01T00:00:00Z"}, 0, ExpiryExpired, true},
+	{"earlier wins", map[string]any{"expires_at": "2999-01-01T00:00:00Z", "max_age": "1h"}, 2 * time.Hour, ExpiryExpired, true},
+	{"invalid max age", map[string]any{"max_age": "soon"}, 0, ExpiryInvalid, true},
+	{"invalid expires at", map[string]any{"expires_at": "tomorrow"}, 0, ExpiryInvalid, true},
+}
+
+func TestFolderExpiryFromMetadata(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range folderExpiryTests {
+		t.Run(test.name, func(t *testing.T) {
+			metadata := map[string]any{
+				"custom_metadata": test.custom,
+				"updated_time":    now.Add(-test.updatedAgo).Format(time.RFC3339Nano),
+			}
+
+			expiry, tagged := folderExpiryFromMetadata("db", metadata, now, DefaultExpiryWarning)
+			assert.Equal(t, test.tagged, tagged)
+			assert.Equal(t, test.expectedState, expiry.State)
+			if test.expectedState == ExpiryInvalid {
+				assert.True(t, errors.Is(expiry.Err, ErrInvalidExpiry))
+			}
+		})
+	}
+}
+
+func TestExpiryTracking(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "secret"})
+	fv.putSecret("kv/main/api", map[string]any{"api_key": "key"})
+	fv.putSecret("kv/main/kafka", map[string]any{"brokers": "b1:9092"})
+	fv.tagSecret("kv/main/db", map[string]any{"max_age": "90d"}, time.Now().Add(-100*24*time.Hour))
+	fv.tagSecret("kv/main/api", map[string]any{"max_age": "90d"}, time.Now().Add(-24*time.Hour))
+
+	metrics := &recordingMetrics{gauges: make(map[string]float64)}
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithMount("kv", "main"),
+		WithMetrics(metrics),
+		WithExpiryTracking(DefaultExpiryWarning),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, sm.ReloadConfig())
+
+	expiries := sm.SecretExpiries()
+	require.Len(t, expiries, 2)
+	assert.Equal(t, "db", expiries[0].Folder)
+	assert.Equal(t, ExpiryExpired, expiries[0].State)
+	assert.Equal(t, "api", expiries[1].Folder)
+	assert.Equal(t, ExpiryOK, expiries[1].State)
+
+	status := sm.Status()
+	require.Len(t, status.ExpiringSecrets, 1)
+	assert.Equal(t, "db", status.ExpiringSecrets[0].Folder)
+	assert.False(t, status.ExpiryCheckedAt.IsZero())
+
+	assert.Equal(t, float64(1), metrics.gauges[MetricSecretsExpired])
+	assert.Equal(t, float64(0), metrics.gauges[MetricSecretsExpiring])
+	assert.Less(t, metrics.gauges[MetricSecretExpiresIn+"/db"], float64(0))
+
+	checked, err := sm.CheckExpiry(context.Background(), 200*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, checked, 2)
+	assert.Equal(t, ExpiryWarning, checked[1].State)
+
+	sm.SetExpiryTracking(0)
+	assert.Empty(t, sm.Status().ExpiringSecrets)
+}
+
+func TestExpiryTrailingSlashFolder(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/app", map[string]any{"api_key": "key"})
+	fv.tagSecret("kv/main/app", map[string]any{"max_age": "90d"}, time.Now().Add(-100*24*time.Hour))
+
+	// секрет с именем "app/", как в интеграционном тесте: листинг отдает его со слешем на конце
+	fv.handle("kv/metadata/main", func(r *fakeRequest) any {
+		if r.method != "LIST" {
+			return fv.serveKV(r)
+		}
+		return map[string]any{"data": map[string]any{"keys": []any{"app/"}}}
+	})
+
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithMount("kv", "main"),
+		WithExpiryTracking(DefaultExpiryWarning),
+	)
+	require.NoError(t, err)
+	require.NoError(t, sm.ReloadConfig())
+
+	expiries := sm.SecretExpiries()
+	require.Len(t, expiries, 1)
+	assert.Equal(t, "app/", expiries[0].Folder)
+	assert.Equal(t, ExpiryExpired, expiries[0].State)
+
+	checked, err := sm.CheckExpiry(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, checked, 1)
+	assert.Equal(t, "app/", checked[0].Folder)
+}
+
+func TestExpiryStaleGauges(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "secret"})
+	fv.putSecret("kv/main/api", map[string]any{"api_key": "key"})
+	fv.tagSecret("kv/main/db", map[string]any{"max_age": "90d"}, time.Now().Add(-100*24*time.Hour))
+	fv.tagSecret("kv/main/api", map[string]any{"max_age": "90d"}, time.Now())
+
+	metrics := &recordingMetrics{gauges: make(map[string]float64)}
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithMount("kv", "main"),
+		WithMetrics(metrics),
+		WithExpiryTracking(DefaultExpiryWarning),
+	)
+	require.NoError(t, err)
+	require.NoError(t, sm.ReloadConfig())
+
+	_, tracked := metrics.gauge(MetricSecretExpiresIn + "/db")
+	assert.True(t, tracked)
+
+	// разметку сняли - серия пропадает, а не висит с последним значением
+	fv.tagSecret("kv/main/db", nil, time.Now())
+	require.NoError(t, sm.ReloadConfig())
+
+	_, tracked = metrics.gauge(MetricSecretExpiresIn + "/db")
+	assert.False(t, tracked)
+	_, tracked = metrics.gauge(MetricSecretExpiresIn + "/api")
+	assert.True(t, tracked)
+
+	sm.SetExpiryTracking(0)
+	_, tracked = metrics.gauge(MetricSecretExpiresIn + "/api")
+	assert.False(t, tracked)
+}
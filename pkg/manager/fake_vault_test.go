@@ -0,0 +1,569 @@
+package manager
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault - минимальный vault на httptest для тестов, которым не нужен контейнер.
+// Умеет KV v1 и KV v2 с версиями, метаданными, CAS и patch, плюс sys/internal/ui/mounts.
+// Остальное добавляется через handle
+type fakeVault struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	mounts   map[string]int                      // "kv/" -> версия KV
+	secrets  map[string]*fakeKVSecret            // "kv/main/db" -> секрет с версиями
+	handlers map[string]func(r *fakeRequest) any // "sys/seal-status" -> обработчик
+}
+
+type fakeRequest struct {
+	method string
+	path   string
+	query  map[string][]string
+	body   map[string]any
+	token  string
+	header http.Header
+}
+
+// fakeVaultError - если обработчик вернул его, клиент получит ответ с этим кодом
+type fakeVaultError struct {
+	code     int
+	messages []string
+	body     any // если задан, отдается вместо {"errors": messages}
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	fv := &fakeVault{
+		mounts:   make(map[string]int),
+		secrets:  make(map[string]*fakeKVSecret),
+		handlers: make(map[string]func(r *fakeRequest) any),
+	}
+
+	fv.server = httptest.NewServer(http.HandlerFunc(fv.serveHTTP))
+	t.Cleanup(fv.server.Close)
+
+	return fv
+}
+
+// testManagerSetup - фейковый vault и менеджер над ним для newTestManager
+type testManagerSetup struct {
+	mounts  map[string]int            // маунт -> версия KV
+	secrets map[string]map[string]any // логический путь вида "kv/main/db" -> данные
+	options []Option                  // поверх адреса и токена фейкового vault'a
+}
+
+// withKVVersion - тот же setup, но с маунтом kv другой версии
+func (s testManagerSetup) withKVVersion(version int) testManagerSetup {
+	s.mounts = maps.Clone(s.mounts)
+	s.mounts["kv"] = version
+	return s
+}
+
+// newTestManager поднимает фейковый vault по setup и менеджер над ним с уже загруженным конфигом.
+// opts добавляются после setup.options
+// newFakeVault - фейковый vault с маунтами и секретами из setup, без менеджера
+func (s testManagerSetup) newFakeVault(t *testing.T) *fakeVault {
+	fv := newFakeVault(t)
+	for mount, version := range s.mounts {
+		fv.addMount(mount, version)
+	}
+	for path, data := range s.secrets {
+		fv.putSecret(path, data)
+	}
+
+	return fv
+}
+
+// newManager - менеджер с опциями из setup на уже поднятом fv, без ReloadConfig
+func (s testManagerSetup) newManager(t *testing.T, fv *fakeVault, opts ...Option) *SecretManagerVault {
+	sm, err := fv.newManager(append(slices.Clone(s.options), opts...)...)
+	require.NoError(t, err)
+
+	return sm
+}
+
+func newTestManager(t *testing.T, setup testManagerSetup, opts ...Option) (*fakeVault, *SecretManagerVault) {
+	fv := setup.newFakeVault(t)
+
+	sm := setup.newManager(t, fv, opts...)
+	require.NoError(t, sm.ReloadConfig())
+
+	return fv, sm
+}
+
+// newManager - еще один менеджер над тем же фейковым vault'ом, без загрузки конфига
+func (fv *fakeVault) newManager(opts ...Option) (*SecretManagerVault, error) {
+	return NewSecretManagerWithOptions(append([]Option{WithAddress(fv.server.URL), WithToken(testVaultToken)}, opts...)...)
+}
+
+func (fv *fakeVault) addMount(mount string, version int) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	fv.mounts[normalizeMount(mount)] = version
+}
+
+// putSecret кладет новую версию секрета по логическому пути без data/metadata, например "kv/main/db"
+func (fv *fakeVault) putSecret(path string, data map[string]any) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	path = strings.Trim(path, "/")
+	secret, exists := fv.secrets[path]
+	if !exists {
+		secret = &fakeKVSecret{}
+		fv.secrets[path] = secret
+	}
+	secret.versions = append(secret.versions, &fakeKVVersion{data: data, created: time.Now()})
+}
+
+// secretData - последняя версия секрета, nil если его нет или он удален
+func (fv *fakeVault) secretData(path string) map[string]any {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	secret, exists := fv.secrets[strings.Trim(path, "/")]
+	if !exists || len(secret.versions) == 0 || secret.latest().deleted {
+		return nil
+	}
+
+	return secret.latest().data
+}
+
+func (fv *fakeVault) handle(path string, handler func(r *fakeRequest) any) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	fv.handlers[strings.Trim(path, "/")] = handler
+}
+
+func (fv *fakeVault) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &fakeRequest{
+		method: r.Method,
+		path:   strings.TrimPrefix(r.URL.Path, "/v1/"),
+		query:  r.URL.Query(),
+		token:  r.Header.Get("X-Vault-Token"),
+		header: r.Header,
+	}
+	if r.URL.Query().Get("list") == "true" {
+		req.method = "LIST"
+	}
+	if r.Body != nil {
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		_ = decoder.Decode(&req.body)
+	}
+
+	fv.mu.Lock()
+	handler, ok := fv.handlers[strings.Trim(req.path, "/")]
+	fv.mu.Unlock()
+
+	var resp any
+	if ok {
+		resp = handler(req)
+	} else {
+		resp = fv.serveKV(req)
+	}
+
+	switch v := resp.(type) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case *fakeVaultError:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(v.code)
+		if v.body != nil {
+			_ = json.NewEncoder(w).Encode(v.body)
+			break
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": v.messages})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func (fv *fakeVault) serveKV(req *fakeRequest) any {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	if strings.HasPrefix(req.path, "sys/internal/ui/mounts/") {
+		return fv.serveUIMount(strings.TrimPrefix(req.path, "sys/internal/ui/mounts/"))
+	}
+
+	mount, version, rest, ok := fv.findMount(req.path)
+	if !ok {
+		return &fakeVaultError{code: http.StatusNotFound, messages: []string{"no handler for route"}}
+	}
+
+	if version == KVVersion1 {
+		return fv.serveKVv1(req, strings.Trim(mount+rest, "/"))
+	}
+
+	route, rest, _ := strings.Cut(rest, "/")
+	return fv.serveKVv2(req, route, strings.Trim(mount+rest, "/"))
+}
+
+// fakeMergePatch - RFC 7386, как его применяет vault: вложенные объекты сливаются, nil удаляет ключ
+func fakeMergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, _ := target.(map[string]any)
+	merged := make(map[string]any, len(targetObject))
+	for k, v := range targetObject {
+		merged[k] = v
+	}
+	for k, v := range patchObject {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = fakeMergePatch(merged[k], v)
+	}
+
+	return merged
+}
+
+func (fv *fakeVault) serveKVv1(req *fakeRequest, logicalPath string) any {
+	switch req.method {
+	case "LIST":
+		return fv.listResponseLocked(logicalPath)
+	case http.MethodGet:
+		secret, exists := fv.secrets[logicalPath]
+		if !exists {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+		return map[string]any{"data": secret.latest().data}
+	case http.MethodPost, http.MethodPut:
+		fv.secrets[logicalPath] = &fakeKVSecret{versions: []*fakeKVVersion{{data: req.body, created: time.Now()}}}
+		return nil
+	case http.MethodDelete:
+		delete(fv.secrets, logicalPath)
+		return nil
+	}
+
+	return &fakeVaultError{code: http.StatusMethodNotAllowed}
+}
+
+func (fv *fakeVault) serveKVv2(req *fakeRequest, route, logicalPath string) any {
+	secret := fv.secrets[logicalPath]
+
+	switch {
+	case route == "metadata" && req.method == "LIST":
+		return fv.listResponseLocked(logicalPath)
+	case route == "metadata" && req.method == http.MethodGet:
+		if secret == nil {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+		return map[string]any{"data": secret.metadataResponse()}
+	case route == "metadata" && (req.method == http.MethodPost || req.method == http.MethodPut):
+		if secret == nil {
+			secret = &fakeKVSecret{}
+			fv.secrets[logicalPath] = secret
+		}
+		if custom, ok := req.body["custom_metadata"].(map[string]any); ok {
+			secret.customMetadata = custom
+		}
+		return nil
+	case route == "data" && req.method == http.MethodGet:
+		if secret == nil || len(secret.versions) == 0 {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+
+		versionNumber := len(secret.versions)
+		if requested := req.query["version"]; len(requested) > 0 && requested[0] != "0" {
+			versionNumber, _ = strconv.Atoi(requested[0])
+		}
+		if versionNumber < 1 || versionNumber > len(secret.versions) {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+
+		v := secret.versions[versionNumber-1]
+		metadata := v.metadata(versionNumber)
+		if v.deleted || v.destroyed {
+			// vault отдает 404 с метаданными, клиент превращает это в ответ с data: null
+			return &fakeVaultError{code: http.StatusNotFound, body: map[string]any{
+				"data": map[string]any{"data": nil, "metadata": metadata},
+			}}
+		}
+		return map[string]any{"data": map[string]any{"data": v.data, "metadata": metadata}}
+	case route == "data" && (req.method == http.MethodPost || req.method == http.MethodPut):
+		data, _ := req.body["data"].(map[string]any)
+		if casErr := checkFakeCAS(req, secret); casErr != nil {
+			return casErr
+		}
+		if secret == nil {
+			secret = &fakeKVSecret{}
+			fv.secrets[logicalPath] = secret
+		}
+		secret.versions = append(secret.versions, &fakeKVVersion{data: data, created: time.Now()})
+		return map[string]any{"data": secret.latest().metadata(len(secret.versions))}
+	case route == "data" && req.method == http.MethodPatch:
+		if secret == nil || secret.latest().deleted || secret.latest().destroyed {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+		if casErr := checkFakeCAS(req, secret); casErr != nil {
+			return casErr
+		}
+		patch, _ := req.body["data"].(map[string]any)
+		merged, _ := fakeMergePatch(secret.latest().data, patch).(map[string]any)
+		secret.versions = append(secret.versions, &fakeKVVersion{data: merged, created: time.Now()})
+		return map[string]any{"data": secret.latest().metadata(len(secret.versions))}
+	case route == "data" && req.method == http.MethodDelete:
+		if secret != nil && len(secret.versions) > 0 {
+			secret.latest().deleted = true
+		}
+		return nil
+	case route == "delete" || route == "undelete" || route == "destroy":
+		if secret == nil {
+			return &fakeVaultError{code: http.StatusNotFound}
+		}
+		versions, _ := req.body["versions"].([]any)
+		for _, raw := range versions {
+			number, _ := strconv.Atoi(raw.(json.Number).String())
+			if number < 1 || number > len(secret.versions) {
+				continue
+			}
+			v := secret.versions[number-1]
+			switch route {
+			case "delete":
+				v.deleted = true
+			case "undelete":
+				v.deleted = false
+			case "destroy":
+				v.destroyed = true
+				v.data = nil
+			}
+		}
+		return nil
+	}
+
+	return &fakeVaultError{code: http.StatusNotFound, messages: []string{"unsupported kv v2 route"}}
+}
+
+func checkFakeCAS(req *fakeRequest, secret *fakeKVSecret) *fakeVaultError {
+	options, _ := req.body["options"].(map[string]any)
+	cas, ok := options["cas"].(json.Number)
+	if !ok {
+		return nil
+	}
+
+	current := 0
+	if secret != nil {
+		current = len(secret.versions)
+	}
+	if cas.String() != strconv.Itoa(current) {
+		return &fakeVaultError{code: http.StatusBadRequest, messages: []string{
+			"check-and-set parameter did not match the current version",
+		}}
+	}
+
+	return nil
+}
+
+func (fv *fakeVault) listResponseLocked(logicalPath string) any {
+	keys := fv.listLocked(logicalPath)
+	if len(keys) == 0 {
+		return &fakeVaultError{code: http.StatusNotFound}
+	}
+	return map[string]any{"data": map[string]any{"keys": keys}}
+}
+
+// fakeKVSecret - секрет с историей версий, для v1 версия всегда одна
+type fakeKVSecret struct {
+	versions       []*fakeKVVersion
+	customMetadata map[string]any
+}
+
+type fakeKVVersion struct {
+	data      map[string]any
+	created   time.Time
+	deleted   bool
+	destroyed bool
+}
+
+func (s *fakeKVSecret) latest() *fakeKVVersion {
+	return s.versions[len(s.versions)-1]
+}
+
+func (v *fakeKVVersion) metadata(number int) map[string]any {
+	deletionTime := ""
+	if v.deleted {
+		deletionTime = v.created.Format(time.RFC3339Nano)
+	}
+
+	return map[string]any{
+		"version":       number,
+		"created_time":  v.created.Format(time.RFC3339Nano),
+		"deletion_time": deletionTime,
+		"destroyed":     v.destroyed,
+	}
+}
+
+func (s *fakeKVSecret) metadataResponse() map[string]any {
+	versions := make(map[string]any, len(s.versions))
+	updated := time.Time{}
+	for i, v := range s.versions {
+		versions[strconv.Itoa(i+1)] = v.metadata(i + 1)
+		updated = v.created
+	}
+
+	return map[string]any{
+		"current_version": len(s.versions),
+		"oldest_version":  1,
+		"updated_time":    updated.Format(time.RFC3339Nano),
+		"custom_metadata": s.customMetadata,
+		"versions":        versions,
+	}
+}
+
+func (fv *fakeVault) findMount(path string) (string, int, string, bool) {
+	for mount, version := range fv.mounts {
+		if strings.HasPrefix(path+"/", mount) {
+			return mount, version, strings.TrimPrefix(path, strings.TrimSuffix(mount, "/")+"/"), true
+		}
+	}
+
+	return "", 0, "", false
+}
+
+func (fv *fakeVault) serveUIMount(path string) any {
+	mount, version, _, ok := fv.findMount(path)
+	if !ok {
+		return &fakeVaultError{code: http.StatusBadRequest, messages: []string{"preflight capability check returned 403"}}
+	}
+
+	options := map[string]any{}
+	if version == KVVersion2 {
+		options["version"] = "2"
+	}
+
+	return map[string]any{"data": map[string]any{"path": mount, "type": "kv", "options": options}}
+}
+
+// listLocked возвращает непосредственных потомков префикса так же, как LIST в vault'e
+func (fv *fakeVault) listLocked(prefix string) []any {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	children := make(map[string]struct{})
+	for path := range fv.secrets {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(path, prefix)
+		if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+			rest = rest[:idx+1]
+		}
+		children[rest] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(children))
+	for child := range children {
+		sorted = append(sorted, child)
+	}
+	sort.Strings(sorted)
+
+	keys := make([]any, len(sorted))
+	for i, child := range sorted {
+		keys[i] = child
+	}
+
+	return keys
+}
+
+// fakeSeal - состояние печати для sys/seal-status и sys/unseal
+type fakeSeal struct {
+	mu        sync.Mutex
+	sealed    bool
+	threshold int
+	validKeys map[string]struct{}
+	entered   map[string]struct{}
+}
+
+// enableSeal запечатывает фейковый vault: распечатать его можно threshold разными ключами из keys
+func (fv *fakeVault) enableSeal(keys []string, threshold int) *fakeSeal {
+	seal := &fakeSeal{
+		sealed:    true,
+		threshold: threshold,
+		validKeys: make(map[string]struct{}, len(keys)),
+		entered:   make(map[string]struct{}),
+	}
+	for _, key := range keys {
+		seal.validKeys[key] = struct{}{}
+	}
+
+	fv.handle("sys/seal-status", func(r *fakeRequest) any {
+		return seal.status()
+	})
+	fv.handle("sys/unseal", func(r *fakeRequest) any {
+		seal.mu.Lock()
+		defer seal.mu.Unlock()
+
+		if reset, _ := r.body["reset"].(bool); reset {
+			seal.entered = make(map[string]struct{})
+			return seal.statusLocked()
+		}
+
+		key, _ := r.body["key"].(string)
+		if _, ok := seal.validKeys[key]; !ok {
+			return &fakeVaultError{code: http.StatusBadRequest, messages: []string{"Unseal failed, invalid key"}}
+		}
+
+		seal.entered[key] = struct{}{}
+		if len(seal.entered) >= seal.threshold {
+			seal.sealed = false
+			seal.entered = make(map[string]struct{})
+		}
+
+		return seal.statusLocked()
+	})
+
+	return seal
+}
+
+func (s *fakeSeal) seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sealed = true
+}
+
+func (s *fakeSeal) isSealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sealed
+}
+
+func (s *fakeSeal) status() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.statusLocked()
+}
+
+func (s *fakeSeal) statusLocked() map[string]any {
+	return map[string]any{
+		"type":        "shamir",
+		"initialized": true,
+		"sealed":      s.sealed,
+		"t":           s.threshold,
+		"n":           len(s.validKeys),
+		"progress":    len(s.entered),
+	}
+}
@@ -0,0 +1,226 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	KVVersion1 = 1
+	KVVersion2 = 2
+)
+
+var (
+	ErrMountNotFound    = errors.New("secrets engine mount not found")
+	ErrNotKVMount       = errors.New("mount is not a kv secrets engine")
+	ErrMountNotReadable = errors.New("mount is not readable with the provided token")
+	ErrPathMismatch     = errors.New("basePath and baseMetaPath point at different locations")
+)
+
+// kvMount - где лежат секреты: имя маунта, логический префикс внутри него и версия движка KV
+type kvMount struct {
+	mount   string
+	prefix  string
+	version int
+}
+
+// dataPath - путь, по которому читаются секреты. Для v1 чтение и листинг идут по одному и тому же пути
+func (m kvMount) dataPath() string {
+	if m.version == KVVersion1 {
+		return m.mount + m.prefix
+	}
+
+	return m.mount + "data/" + m.prefix
+}
+
+// metaPath - путь, по которому листятся папки
+func (m kvMount) metaPath() string {
+	if m.version == KVVersion1 {
+		return m.mount + m.prefix
+	}
+
+	return m.mount + "metadata/" + m.prefix
+}
+
+// versionsPath - путь к служебным операциям KV v2 над версиями: delete, undelete, destroy
+func (m kvMount) versionsPath(route string) string {
+	return m.mount + route + "/" + m.prefix
+}
+
+// normalizeMount приводит имя маунта к виду "kv/"
+func normalizeMount(mount string) string {
+	return strings.Trim(mount, "/") + "/"
+}
+
+// normalizePrefix приводит префикс к виду "main/", пустой префикс остается пустым
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return prefix + "/"
+}
+
+// detectKVMount спрашивает у vault'a, какой маунт обслуживает путь и какой версии там KV.
+// sys/internal/ui/mounts доступен любому токену, у которого есть хоть какие-то права на этот путь
+func detectKVMount(client *vaultapi.Client, path string) (kvMount, error) {
+	resp, err := client.Logical().Read("sys/internal/ui/mounts/" + strings.Trim(path, "/"))
+	if err != nil {
+		return kvMount{}, fmt.Errorf("detecting mount for %q: %w", path, err)
+	}
+
+	if resp == nil || resp.Data == nil {
+		return kvMount{}, fmt.Errorf("%w: %q", ErrMountNotFound, path)
+	}
+
+	mountType, _ := resp.Data["type"].(string)
+	if mountType != "kv" && mountType != "generic" {
+		return kvMount{}, fmt.Errorf("%w: %q has type %q", ErrNotKVMount, path, mountType)
+	}
+
+	mountPath, _ := resp.Data["path"].(string)
+	if mountPath == "" {
+		mountPath = path
+	}
+
+	version := KVVersion1
+	if options, ok := resp.Data["options"].(map[string]interface{}); ok {
+		if optVersion, _ := options["version"].(string); optVersion == "2" {
+			version = KVVersion2
+		}
+	}
+
+	return kvMount{mount: normalizeMount(mountPath), version: version}, nil
+}
+
+// kvMountFromPaths восстанавливает маунт и префикс из пары готовых путей и проверяет, что они смотрят в одно место.
+// Одинаковые пути - это KV v1, иначе ждем "<mount>/data/<prefix>" и "<mount>/metadata/<prefix>".
+// Так опечатка вроде kv/data/main/ + kv/metadata/mian/ ловится при создании, а не молча читает пустоту
+func kvMountFromPaths(basePath, baseMetaPath string) (kvMount, error) {
+	if basePath == baseMetaPath {
+		mount, prefix, _ := strings.Cut(strings.Trim(basePath, "/"), "/")
+		return kvMount{mount: normalizeMount(mount), prefix: normalizePrefix(prefix), version: KVVersion1}, nil
+	}
+
+	segments := strings.Split(strings.Trim(basePath, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i] != "data" {
+			continue
+		}
+
+		candidate := kvMount{
+			mount:   normalizeMount(strings.Join(segments[:i], "/")),
+			prefix:  normalizePrefix(strings.Join(segments[i+1:], "/")),
+			version: KVVersion2,
+		}
+		if candidate.dataPath() == basePath && candidate.metaPath() == baseMetaPath {
+			return candidate, nil
+		}
+
+		return kvMount{}, fmt.Errorf(
+			"%w: basePath %q expects baseMetaPath %q, got %q", ErrPathMismatch, basePath, candidate.metaPath(), baseMetaPath,
+		)
+	}
+
+	return kvMount{}, fmt.Errorf(
+		"%w: basePath %q has no data/ segment and differs from baseMetaPath %q", ErrPathMismatch, basePath, baseMetaPath,
+	)
+}
+
+// checkKVMountReadable листит базовый путь, чтобы токен без прав отвалился при создании, а не в апдейтере.
+// Пустой префикс (404) - не ошибка, секреты туда могут просто еще не записать
+func checkKVMountReadable(client *vaultapi.Client, kv kvMount) error {
+	_, err := client.Logical().List(kv.metaPath())
+	if err == nil {
+		return nil
+	}
+
+	var respErr *vaultapi.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %q: %w", ErrMountNotReadable, kv.metaPath(), err)
+	}
+
+	return err
+}
+
+// readSecret читает папку относительно basePath вместе с версией, которую отдал vault (для v1 всегда 0).
+// version > 0 читает конкретную версию, это есть только в v2. Пустая, удаленная или уничтоженная версия - ErrEmptyVaultResponse
+func (sm *SecretManagerVault) readSecret(ctx context.Context, folder string, version int) (map[string]any, int, error) {
+	return sm.readSecretFrom(ctx, sm.kv, folder, version)
+}
+
+// readSecretFrom - readSecret по любому пути KV, а не только по основному
+func (sm *SecretManagerVault) readSecretFrom(ctx context.Context, kv kvMount, folder string, version int) (map[string]any, int, error) {
+	var vaultResponse *vaultapi.Secret
+	var err error
+	if version > 0 {
+		vaultResponse, err = sm.vaultClient.Logical().ReadWithDataWithContext(ctx, kv.dataPath()+folder,
+			map[string][]string{"version": {strconv.Itoa(version)}})
+	} else {
+		vaultResponse, err = sm.vaultClient.Logical().ReadWithContext(ctx, kv.dataPath()+folder)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if vaultResponse == nil || vaultResponse.Data == nil {
+		return nil, 0, ErrEmptyVaultResponse
+	}
+
+	if kv.version == KVVersion2 && vaultResponse.Data["data"] == nil {
+		return nil, 0, ErrEmptyVaultResponse
+	}
+
+	secretData, ok := extractSecretData(kv, vaultResponse)
+	if !ok {
+		return nil, 0, ErrNotMapInterface
+	}
+
+	return secretData, secretVersionFromResponse(vaultResponse), nil
+}
+
+func secretVersionFromResponse(vaultResponse *vaultapi.Secret) int {
+	metadata, ok := vaultResponse.Data["metadata"].(map[string]any)
+	if !ok {
+		return 0
+	}
+
+	return versionFromAny(metadata["version"])
+}
+
+// extractSecretData достает пары ключ-значение из ответа на чтение. В v2 они лежат во вложенном "data"
+func extractSecretData(kv kvMount, vaultResponse *vaultapi.Secret) (map[string]interface{}, bool) {
+	if kv.version == KVVersion1 {
+		return vaultResponse.Data, true
+	}
+
+	secretData, ok := vaultResponse.Data["data"].(map[string]interface{})
+	return secretData, ok
+}
+
+// writeSecretData пишет пары ключ-значение в папку относительно basePath. В v2 данные заворачиваются в "data",
+// options (например cas) передаются только туда, в v1 их не бывает
+func (sm *SecretManagerVault) writeSecretData(
+	ctx context.Context,
+	folder string,
+	data map[string]any,
+	options map[string]any,
+) (*vaultapi.Secret, error) {
+	if sm.kv.version == KVVersion1 {
+		return sm.vaultClient.Logical().WriteWithContext(ctx, sm.basePath+folder, data)
+	}
+
+	payload := map[string]any{"data": data}
+	if len(options) > 0 {
+		payload["options"] = options
+	}
+
+	return sm.vaultClient.Logical().WriteWithContext(ctx, sm.basePath+folder, payload)
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var kvMountPathsTests = []struct {
+	name             string
+	kv               kvMount
+	expectedDataPath string
+	expectedMetaPath string
+}{
+	{"v2", kvMount{mount: "kv/", prefix: "main/", version: KVVersion2}, "kv/data/main/", "kv/metadata/main/"},
+	{"v2 no prefix", kvMount{mount: "kv/", version: KVVersion2}, "kv/data/", "kv/metadata/"},
+	{"v1", kvMount{mount: "legacy/", prefix: "main/", version: KVVersion1}, "legacy/main/", "legacy/main/"},
+}
+
+func TestKVMountPaths(t *testing.T) {
+	for _, test := range kvMountPathsTests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedDataPath, test.kv.dataPath())
+			assert.Equal(t, test.expectedMetaPath, test.kv.metaPath())
+		})
+	}
+}
+
+var kvVersionsTests = []struct {
+	name    string
+	version int
+}{
+	{"kv v1", KVVersion1},
+	{"kv v2", KVVersion2},
+}
+
+func TestSecretManagerForMount(t *testing.T) {
+	for _, test := range kvVersionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.addMount("kv", test.version)
+			fv.putSecret("kv/main/db", map[string]any{"db_password": "secret"})
+			fv.putSecret("kv/main/kafka/brokers", map[string]any{"brokers": "b1:9092"})
+			fv.putSecret("kv/other/ignored", map[string]any{"ignored": "value"})
+
+			sm, err := NewSecretManagerForMount(fv.server.URL, testVaultToken, "kv", "/main/", nilLogger)
+			require.NoError(t, err)
+			assert.Equal(t, test.version, sm.kv.version)
+
+			require.NoError(t, sm.ReloadConfig())
+			assert.Equal(t, config{"db_password": "secret", "brokers": "b1:9092"}, sm.config)
+
+			value, err := sm.UpdateSpecificSecret("db", "db_password")
+			assert.NoError(t, err)
+			assert.Equal(t, "secret", value)
+		})
+	}
+}
+
+func TestSecretManagerForMissingMount(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+
+	_, err := NewSecretManagerForMount(fv.server.URL, testVaultToken, "nope", "main", nilLogger)
+	assert.Error(t, err)
+
+	fv.handle("sys/internal/ui/mounts/transit", func(r *fakeRequest) any {
+		return map[string]any{"data": map[string]any{"path": "transit/", "type": "transit"}}
+	})
+	_, err = NewSecretManagerForMount(fv.server.URL, testVaultToken, "transit", "main", nilLogger)
+	assert.True(t, errors.Is(err, ErrNotKVMount))
+}
+
+var kvMountFromPathsTests = []struct {
+	name         string
+	basePath     string
+	baseMetaPath string
+	expected     kvMount
+	expectedErr  error
+}{
+	{"defaults", DefaultBasePathData, DefaultBasePathMetaData, kvMount{mount: "kv/", version: KVVersion2}, nil},
+	{"v2 with prefix", "kv/data/main/", "kv/metadata/main/", kvMount{mount: "kv/", prefix: "main/", version: KVVersion2}, nil},
+	{"nested mount", "team/kv/data/main/", "team/kv/metadata/main/", kvMount{mount: "team/kv/", prefix: "main/", version: KVVersion2}, nil},
+	{"v1", "legacy/main/", "legacy/main/", kvMount{mount: "legacy/", prefix: "main/", version: KVVersion1}, nil},
+	{"typo in prefix", "kv/data/main/", "kv/metadata/mian/", kvMount{}, ErrPathMismatch},
+	{"different mounts", "kv/data/main/", "kv2/metadata/main/", kvMount{}, ErrPathMismatch},
+	{"no data segment", "kv/main/", "kv/metadata/main/", kvMount{}, ErrPathMismatch},
+}
+
+func TestKVMountFromPaths(t *testing.T) {
+	for _, test := range kvMountFromPathsTests {
+		t.Run(test.name, func(t *testing.T) {
+			kv, err := kvMountFromPaths(test.basePath, test.baseMetaPath)
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.Equal(t, test.expected, kv)
+		})
+	}
+}
+
+func TestNewSecretManagerRejectsMismatchedPaths(t *testing.T) {
+	_, err := NewSecretManager("", testVaultToken, "kv/data/main/", "kv/metadata/mian/", nilZapLogger)
+	assert.True(t, errors.Is(err, ErrPathMismatch))
+}
+
+func TestSecretManagerForUnreadableMount(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.handle("kv/metadata/main/", func(r *fakeRequest) any {
+		return &fakeVaultError{code: http.StatusForbidden, messages: []string{"permission denied"}}
+	})
+
+	_, err := NewSecretManagerForMount(fv.server.URL, testVaultToken, "kv", "main", nilLogger)
+	assert.True(t, errors.Is(err, ErrMountNotReadable), "got error %v", err)
+}
@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"log/slog"
+
+	"go.uber.org/zap"
+)
+
+// NewSlogLogger оборачивает *slog.Logger. Нужен только для nil: тогда берется slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+
+	return logger
+}
+
+// NewZapLogger оборачивает *zap.SugaredLogger. Пары ключ-значение уходят в zap как поля через *w методы, nil - тишина
+func NewZapLogger(logger *zap.SugaredLogger) Logger {
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+
+	return &zapLogger{logger: logger}
+}
+
+// NewNopLogger - логгер, который все выбрасывает
+func NewNopLogger() Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+type zapLogger struct {
+	logger *zap.SugaredLogger
+}
+
+func (l *zapLogger) Debug(msg string, args ...any) {
+	l.logger.Debugw(msg, args...)
+}
+
+func (l *zapLogger) Info(msg string, args ...any) {
+	l.logger.Infow(msg, args...)
+}
+
+func (l *zapLogger) Warn(msg string, args ...any) {
+	l.logger.Warnw(msg, args...)
+}
+
+func (l *zapLogger) Error(msg string, args ...any) {
+	l.logger.Errorw(msg, args...)
+}
@@ -0,0 +1,33 @@
+package manager
+
+import "math"
+
+// Metrics - куда менеджер отдает свои метрики. Интерфейс нарочно минимальный, чтобы его было легко
+// натянуть на prometheus GaugeVec, expvar или statsd. Подключается через WithMetrics, по умолчанию метрики никуда не идут
+type Metrics interface {
+	SetGauge(name string, labels map[string]string, value float64)
+}
+
+// GaugeDeleter - необязательное расширение Metrics для серий, которые должны пропадать, например
+// GaugeVec.DeleteLabelValues. Если Metrics его не умеет, устаревшая серия гасится значением NaN
+type GaugeDeleter interface {
+	DeleteGauge(name string, labels map[string]string)
+}
+
+func deleteGauge(metrics Metrics, name string, labels map[string]string) {
+	if deleter, ok := metrics.(GaugeDeleter); ok {
+		deleter.DeleteGauge(name, labels)
+		return
+	}
+
+	metrics.SetGauge(name, labels, math.NaN())
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) SetGauge(string, map[string]string, float64) {}
+
+// NewNopMetrics - метрики, которые никуда не пишутся
+func NewNopMetrics() Metrics {
+	return nopMetrics{}
+}
@@ -0,0 +1,530 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	ErrConflictingOptions = errors.New("conflicting secret manager options")
+)
+
+// Option - настройка для NewSecretManagerWithOptions
+type Option func(*managerOptions)
+
+type managerOptions struct {
+	address    string
+	token      string
+	namespace  string
+	timeout    time.Duration
+	maxRetries *int
+
+	tls    vaultapi.TLSConfig
+	tlsSet bool
+
+	httpClient  *http.Client
+	vaultClient *vaultapi.Client
+
+	basePath     string
+	baseMetaPath string
+	pathsSet     bool
+
+	mount    string
+	prefix   string
+	mountSet bool
+
+	vaultPaths []VaultPath
+
+	overlays    bool
+	environment string
+
+	logger Logger
+
+	lenientConversion bool
+	jsonKeys          []string
+
+	pins []pinOption
+
+	metrics          Metrics
+	expiryWarnWithin time.Duration
+
+	databaseMount string
+
+	transitMount string
+	transitKey   string
+
+	wrappingToken string
+	wrappingPaths []string
+	appRole       *appRoleOption
+
+	envOverrides *EnvOverrides
+	sources      []sourceOption
+
+	cache *ConfigCacheOptions
+}
+
+type sourceOption struct {
+	level  SourceLevel
+	source Source
+}
+
+type pinOption struct {
+	folder  string
+	version int
+	ttl     time.Duration
+}
+
+// WithAddress - адрес vault'a. Пустая строка оставляет то, что выставил vaultapi.DefaultConfig (VAULT_ADDR)
+func WithAddress(address string) Option {
+	return func(o *managerOptions) {
+		o.address = address
+	}
+}
+
+// WithToken - токен для запросов. С WithVaultClient выставляется на переданный клиент
+func WithToken(token string) Option {
+	return func(o *managerOptions) {
+		o.token = token
+	}
+}
+
+// WithNamespace - namespace Vault Enterprise. С WithVaultClient выставляется на переданный клиент
+func WithNamespace(namespace string) Option {
+	return func(o *managerOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithTimeout - таймаут одного запроса к vault'у
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *managerOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxRetries - сколько раз vaultapi повторяет запрос на 5xx и 412
+func WithMaxRetries(retries int) Option {
+	return func(o *managerOptions) {
+		o.maxRetries = &retries
+	}
+}
+
+// WithCACert - CA bundle из файла для проверки сертификата vault'a
+func WithCACert(caCertFile string) Option {
+	return func(o *managerOptions) {
+		o.tls.CACert = caCertFile
+		o.tlsSet = true
+	}
+}
+
+// WithCACertPEM - CA bundle в PEM, если он уже лежит в памяти
+func WithCACertPEM(caCertPEM []byte) Option {
+	return func(o *managerOptions) {
+		o.tls.CACertBytes = caCertPEM
+		o.tlsSet = true
+	}
+}
+
+// WithClientCert - клиентский сертификат и ключ для mTLS до vault'a
+func WithClientCert(certFile, keyFile string) Option {
+	return func(o *managerOptions) {
+		o.tls.ClientCert = certFile
+		o.tls.ClientKey = keyFile
+		o.tlsSet = true
+	}
+}
+
+// WithTLSServerName - SNI и имя для проверки сертификата, если ходим в vault не по его имени
+func WithTLSServerName(serverName string) Option {
+	return func(o *managerOptions) {
+		o.tls.TLSServerName = serverName
+		o.tlsSet = true
+	}
+}
+
+// WithInsecureSkipVerify отключает проверку сертификата vault'a. Только для локальной разработки
+func WithInsecureSkipVerify() Option {
+	return func(o *managerOptions) {
+		o.tls.Insecure = true
+		o.tlsSet = true
+	}
+}
+
+// WithHTTPClient - свой http.Client для запросов в vault. TLS в этом случае настраивается в его транспорте
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *managerOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithVaultClient - уже собранный клиент vault'a. Адрес, TLS, таймауты и ретраи в этом случае задаются в нем самом
+func WithVaultClient(client *vaultapi.Client) Option {
+	return func(o *managerOptions) {
+		o.vaultClient = client
+	}
+}
+
+// WithBasePaths - готовые пути до данных и метаданных, как в NewSecretManager
+func WithBasePaths(basePath, baseMetaPath string) Option {
+	return func(o *managerOptions) {
+		o.basePath = basePath
+		o.baseMetaPath = baseMetaPath
+		o.pathsSet = true
+	}
+}
+
+// WithMount - имя маунта и префикс внутри него, как в NewSecretManagerForMount
+func WithMount(mount, prefix string) Option {
+	return func(o *managerOptions) {
+		o.mount = mount
+		o.prefix = prefix
+		o.mountSet = true
+	}
+}
+
+// WithVaultPaths - дополнительные пути, с которых грузится конфиг вместе с основным, например общие секреты
+// для нескольких сервисов. Основной путь (WithMount/WithBasePaths) сильнее всех дополнительных, среди них сильнее
+// переданный позже. Пишет менеджер только в основной путь, версии, закрепления и сроки тоже только для него.
+// Vault должен быть доступен уже при создании, версия KV каждого маунта определяется сама
+func WithVaultPaths(paths ...VaultPath) Option {
+	return func(o *managerOptions) {
+		o.vaultPaths = append(o.vaultPaths, paths...)
+	}
+}
+
+// WithOverlays включает раскладку base/ + overlays/<env>/ под основным путем: сначала грузится база, поверх нее
+// оверлей окружения env. Пустой env берется из переменной VAULT_CONFIG_ENV, если и там пусто - грузится только база.
+// Пишет менеджер в оверлей, версии, закрепления и сроки тоже считаются для него. Апдейтер обновляет оба слоя,
+// что именно меняет оверлей, показывает OverlayDiff
+func WithOverlays(env string) Option {
+	return func(o *managerOptions) {
+		o.overlays = true
+		o.environment = env
+	}
+}
+
+// WithLogger - логгер менеджера. *slog.Logger подходит напрямую, zap оборачивается через NewZapLogger
+func WithLogger(logger Logger) Option {
+	return func(o *managerOptions) {
+		o.logger = logger
+	}
+}
+
+// WithLenientConversion - то же, что SetLenientConversion(true) сразу после создания
+func WithLenientConversion() Option {
+	return func(o *managerOptions) {
+		o.lenientConversion = true
+	}
+}
+
+// WithJSONKeys - то же, что SetJSONKeys сразу после создания
+func WithJSONKeys(keys ...string) Option {
+	return func(o *managerOptions) {
+		o.jsonKeys = keys
+	}
+}
+
+// WithPinnedVersion закрепляет папку на версии KV v2 сразу при создании, как PinFolder. ttl <= 0 - DefaultPinTTL.
+// Можно передать несколько раз для разных папок
+func WithPinnedVersion(folder string, version int, ttl time.Duration) Option {
+	return func(o *managerOptions) {
+		o.pins = append(o.pins, pinOption{folder: folder, version: version, ttl: ttl})
+	}
+}
+
+// WithMetrics - куда отдавать метрики менеджера
+func WithMetrics(metrics Metrics) Option {
+	return func(o *managerOptions) {
+		o.metrics = metrics
+	}
+}
+
+// WithExpiryTracking включает отслеживание сроков по custom_metadata, как SetExpiryTracking
+func WithExpiryTracking(warnWithin time.Duration) Option {
+	return func(o *managerOptions) {
+		o.expiryWarnWithin = warnWithin
+	}
+}
+
+// WithDatabaseMount - маунт database secrets engine для DatabaseCredentials, по умолчанию DefaultDatabaseMount
+func WithDatabaseMount(mount string) Option {
+	return func(o *managerOptions) {
+		o.databaseMount = mount
+	}
+}
+
+// WithTransit включает прозрачную расшифровку значений vault:v1:..., как SetTransitKey
+func WithTransit(mount, key string) Option {
+	return func(o *managerOptions) {
+		o.transitMount = mount
+		o.transitKey = key
+	}
+}
+
+// WithEnvOverrides - перекрытия ключей переменными окружения, как SetEnvOverrides
+func WithEnvOverrides(overrides EnvOverrides) Option {
+	return func(o *managerOptions) {
+		o.envOverrides = &overrides
+	}
+}
+
+// WithSource добавляет источник конфига на уровень level, как AddSource. Можно передать несколько раз,
+// на одном уровне побеждает переданный позже
+func WithSource(level SourceLevel, source Source) Option {
+	return func(o *managerOptions) {
+		o.sources = append(o.sources, sourceOption{level: level, source: source})
+	}
+}
+
+// WithConfigCache включает зашифрованный кэш последнего удачного конфига на диске: он пишется после каждого
+// удачного обновления и читается в ResetConfig/ReloadConfig, если vault недоступен и из него еще ни разу
+// не грузились. С WithMount, WithVaultPaths и логином через AppRole/wrapped token vault нужен уже при создании,
+// для старта без vault'a пути задаются через WithBasePaths
+func WithConfigCache(opts ConfigCacheOptions) Option {
+	return func(o *managerOptions) {
+		o.cache = &opts
+	}
+}
+
+// validate ищет опции, которые не могут работать вместе, и перечисляет все найденные конфликты разом
+func (o *managerOptions) validate() error {
+	conflicts := make([]string, 0, 2)
+
+	if o.vaultClient != nil {
+		if o.address != "" {
+			conflicts = append(conflicts, "WithVaultClient and WithAddress")
+		}
+		if o.tlsSet {
+			conflicts = append(conflicts, "WithVaultClient and TLS options")
+		}
+		if o.httpClient != nil {
+			conflicts = append(conflicts, "WithVaultClient and WithHTTPClient")
+		}
+		if o.timeout != 0 {
+			conflicts = append(conflicts, "WithVaultClient and WithTimeout")
+		}
+		if o.maxRetries != nil {
+			conflicts = append(conflicts, "WithVaultClient and WithMaxRetries")
+		}
+	}
+
+	if o.token != "" && o.wrappingToken != "" {
+		conflicts = append(conflicts, "WithToken and WithWrappedToken")
+	}
+	if o.token != "" && o.appRole != nil {
+		conflicts = append(conflicts, "WithToken and AppRole login")
+	}
+	if o.wrappingToken != "" && o.appRole != nil {
+		conflicts = append(conflicts, "WithWrappedToken and AppRole login")
+	}
+
+	if o.httpClient != nil && o.tlsSet {
+		conflicts = append(conflicts, "WithHTTPClient and TLS options")
+	}
+
+	if o.pathsSet && o.mountSet {
+		conflicts = append(conflicts, "WithBasePaths and WithMount")
+	}
+
+	if o.cache != nil {
+		if err := o.cache.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: %s", ErrConflictingOptions, strings.Join(conflicts, "; "))
+	}
+
+	return nil
+}
+
+func (o *managerOptions) buildVaultClient() (*vaultapi.Client, error) {
+	client := o.vaultClient
+
+	if client == nil {
+		vaultConfig := vaultapi.DefaultConfig()
+		if vaultConfig.Error != nil {
+			return nil, vaultConfig.Error
+		}
+
+		if o.address != "" {
+			vaultConfig.Address = o.address
+		}
+		if o.httpClient != nil {
+			vaultConfig.HttpClient = o.httpClient
+		}
+		if o.timeout != 0 {
+			vaultConfig.Timeout = o.timeout
+		}
+		if o.maxRetries != nil {
+			vaultConfig.MaxRetries = *o.maxRetries
+		}
+		if o.tlsSet {
+			if err := vaultConfig.ConfigureTLS(&o.tls); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		client, err = vaultapi.NewClient(vaultConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.token != "" {
+		client.SetToken(o.token)
+	}
+	if o.namespace != "" {
+		client.SetNamespace(o.namespace)
+	}
+
+	return client, nil
+}
+
+// NewSecretManagerWithOptions собирает менеджер из опций. Без WithBasePaths/WithMount используются
+// DefaultBasePathData и DefaultBasePathMetaData. С WithMount, WithVaultPaths, WithWrappedToken и AppRole
+// vault должен быть доступен уже при создании
+func NewSecretManagerWithOptions(opts ...Option) (*SecretManagerVault, error) {
+	o := &managerOptions{
+		basePath:     DefaultBasePathData,
+		baseMetaPath: DefaultBasePathMetaData,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.logger == nil {
+		o.logger = NewNopLogger()
+	}
+
+	if err := o.validate(); err != nil {
+		o.logger.Error("Error creating secret manager", "error", err)
+		return nil, err
+	}
+
+	client, err := o.buildVaultClient()
+	if err != nil {
+		o.logger.Error("Error creating vault client", "error", err)
+		return nil, err
+	}
+
+	if err = o.authenticate(context.Background(), client); err != nil {
+		o.logger.Error("Error authenticating to vault", "error", err)
+		return nil, err
+	}
+
+	var kv kvMount
+	if o.mountSet {
+		kv, err = detectKVMount(client, o.mount)
+		if err != nil {
+			o.logger.Error("Error detecting kv mount", "mount", o.mount, "error", err)
+			return nil, err
+		}
+		kv.prefix = normalizePrefix(o.prefix)
+
+		if err = checkKVMountReadable(client, kv); err != nil {
+			o.logger.Error("Error checking kv mount", "mount", o.mount, "error", err)
+			return nil, err
+		}
+	} else {
+		kv, err = kvMountFromPaths(withTrailingSlash(o.basePath), withTrailingSlash(o.baseMetaPath))
+		if err != nil {
+			o.logger.Error("Error creating secret manager", "error", err)
+			return nil, err
+		}
+	}
+
+	vaultPaths := make([]kvMount, 0, len(o.vaultPaths)+1)
+	for _, path := range o.vaultPaths {
+		pathKV, err := detectKVMount(client, path.Mount)
+		if err != nil {
+			o.logger.Error("Error detecting kv mount", "mount", path.Mount, "error", err)
+			return nil, err
+		}
+		pathKV.prefix = normalizePrefix(path.Prefix)
+
+		if err = checkKVMountReadable(client, pathKV); err != nil {
+			o.logger.Error("Error checking kv mount", "mount", path.Mount, "error", err)
+			return nil, err
+		}
+		vaultPaths = append(vaultPaths, pathKV)
+	}
+
+	var overlay *overlayLayout
+	if o.overlays {
+		environment := o.environment
+		if environment == "" {
+			environment = os.Getenv(EnvironmentEnvVar)
+		}
+
+		main, base, err := overlayPaths(kv, environment)
+		if err != nil {
+			o.logger.Error("Error creating secret manager", "error", err)
+			return nil, err
+		}
+
+		// база слабее оверлея, но сильнее остальных дополнительных путей
+		if main != base {
+			vaultPaths = append(vaultPaths, base)
+		}
+		kv = main
+		overlay = &overlayLayout{environment: environment, base: base}
+	}
+
+	sm := newSecretManagerWithClient(client, kv, o.logger)
+	sm.vaultPaths = vaultPaths
+	sm.overlay = overlay
+	if o.cache != nil {
+		sm.cache = &configCache{opts: *o.cache}
+	}
+	sm.lenientConversion = o.lenientConversion
+	if o.metrics != nil {
+		sm.metrics = o.metrics
+	}
+	sm.SetExpiryTracking(o.expiryWarnWithin)
+	if o.databaseMount != "" {
+		sm.dbLeases.mount = normalizeMount(o.databaseMount)
+	}
+	if o.transitKey != "" {
+		sm.SetTransitKey(o.transitMount, o.transitKey)
+	}
+	if len(o.jsonKeys) > 0 {
+		_ = sm.SetJSONKeys(o.jsonKeys...) // конфиг еще пустой, разбирать нечего
+	}
+	for _, source := range o.sources {
+		if _, err = sm.addSource(context.Background(), source.level, source.source); err != nil {
+			return nil, err
+		}
+	}
+	if o.envOverrides != nil {
+		if _, err = sm.setEnvOverrides(*o.envOverrides); err != nil {
+			o.logger.Error("Error applying env overrides", "error", err)
+			return nil, err
+		}
+	}
+	for _, pin := range o.pins {
+		if err = sm.PinFolder(pin.folder, pin.version, pin.ttl); err != nil {
+			o.logger.Error("Error pinning folder", "folder", pin.folder, "version", pin.version, "error", err)
+			return nil, err
+		}
+	}
+
+	return sm, nil
+}
+
+func withTrailingSlash(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		return path + "/"
+	}
+
+	return path
+}
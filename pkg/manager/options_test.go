@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestVaultClient(t *testing.T) *vaultapi.Client {
+	client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	require.NoError(t, err)
+	return client
+}
+
+func TestConflictingOptions(t *testing.T) {
+	conflictingOptionsTests := []struct {
+		name string
+		opts []Option
+	}{
+		{"client and address", []Option{WithVaultClient(newTestVaultClient(t)), WithAddress("http://127.0.0.1:8200")}},
+		{"client and tls", []Option{WithVaultClient(newTestVaultClient(t)), WithCACert("/tmp/ca.pem")}},
+		{"client and http client", []Option{WithVaultClient(newTestVaultClient(t)), WithHTTPClient(&http.Client{})}},
+		{"client and timeout", []Option{WithVaultClient(newTestVaultClient(t)), WithTimeout(time.Second)}},
+		{"client and retries", []Option{WithVaultClient(newTestVaultClient(t)), WithMaxRetries(5)}},
+		{"http client and tls", []Option{WithHTTPClient(&http.Client{}), WithInsecureSkipVerify()}},
+		{"paths and mount", []Option{WithBasePaths(testBasePathData, testBasePathMetadata), WithMount("kv", "main")}},
+	}
+
+	for _, test := range conflictingOptionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewSecretManagerWithOptions(test.opts...)
+			assert.True(t, errors.Is(err, ErrConflictingOptions), "got error %v", err)
+		})
+	}
+}
+
+func TestNewSecretManagerWithOptions(t *testing.T) {
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress("http://127.0.0.1:8300"),
+		WithToken(testVaultToken),
+		WithNamespace("team-a"),
+		WithTimeout(3*time.Second),
+		WithMaxRetries(7),
+		WithBasePaths(testBasePathData, testBasePathMetadata),
+		WithLenientConversion(),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://127.0.0.1:8300", sm.vaultClient.Address())
+	assert.Equal(t, testVaultToken, sm.vaultClient.Token())
+	assert.Equal(t, "team-a", sm.vaultClient.Namespace())
+	assert.Equal(t, 3*time.Second, sm.vaultClient.ClientTimeout())
+	assert.Equal(t, 7, sm.vaultClient.MaxRetries())
+	assert.Equal(t, testBasePathData, sm.basePath)
+	assert.Equal(t, testBasePathMetadata, sm.baseMetaPath)
+	assert.True(t, sm.lenientConversion)
+}
+
+func TestNewSecretManagerWithDefaults(t *testing.T) {
+	sm, err := NewSecretManagerWithOptions()
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultBasePathData, sm.basePath)
+	assert.Equal(t, DefaultBasePathMetaData, sm.baseMetaPath)
+}
+
+func TestNewSecretManagerWithExternalClient(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "secret"})
+
+	var namespaces []string
+	fv.handle("kv/data/main/db", func(r *fakeRequest) any {
+		namespaces = append(namespaces, r.header.Get("X-Vault-Namespace"))
+		return map[string]any{"data": map[string]any{"data": map[string]any{"db_password": "secret"}}}
+	})
+
+	client := newTestVaultClient(t)
+	require.NoError(t, client.SetAddress(fv.server.URL))
+
+	sm, err := NewSecretManagerWithOptions(
+		WithVaultClient(client),
+		WithToken(testVaultToken),
+		WithNamespace("team-a"),
+		WithMount("kv", "main"),
+	)
+	require.NoError(t, err)
+	assert.Same(t, client, sm.vaultClient)
+
+	value, err := sm.UpdateSpecificSecret("db", "db_password")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", value)
+	assert.Equal(t, []string{"team-a"}, namespaces)
+}
+
+func TestNewSecretManagerWithBadCA(t *testing.T) {
+	_, err := NewSecretManagerWithOptions(WithCACertPEM([]byte("not a pem")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// EnvironmentEnvVar - переменная окружения с именем окружения для WithOverlays, если оно не передано явно
+const EnvironmentEnvVar = "VAULT_CONFIG_ENV"
+
+const (
+	overlayBaseFolder = "base/"
+	overlaysFolder    = "overlays/"
+)
+
+var (
+	ErrInvalidEnvironment = errors.New("invalid overlay environment")
+	ErrNoOverlay          = errors.New("no overlay environment selected")
+)
+
+// overlayLayout - раскладка base/ + overlays/<env>/ под основным префиксом. Задается при создании и дальше не меняется
+type overlayLayout struct {
+	environment string
+	base        kvMount
+}
+
+// overlayPaths раскладывает основной путь на базу и оверлей. Оверлей становится основным путем (туда пишет менеджер,
+// для него версии, закрепления и сроки), база - самым сильным из дополнительных. Без окружения грузится только база
+func overlayPaths(kv kvMount, environment string) (main kvMount, base kvMount, err error) {
+	if strings.Contains(environment, "/") || environment == "." || environment == ".." {
+		return kvMount{}, kvMount{}, fmt.Errorf("%w: %q", ErrInvalidEnvironment, environment)
+	}
+
+	base = kv
+	base.prefix = kv.prefix + overlayBaseFolder
+	if environment == "" {
+		return base, base, nil
+	}
+
+	main = kv
+	main.prefix = kv.prefix + overlaysFolder + environment + "/"
+	return main, base, nil
+}
+
+// Environment - окружение, чей оверлей грузится поверх базы, пустое, если оверлеев нет
+func (sm *SecretManagerVault) Environment() string {
+	if sm.overlay == nil {
+		return ""
+	}
+
+	return sm.overlay.environment
+}
+
+// OverlayDiff читает базу и оверлей заново и возвращает, что оверлей меняет относительно базы: ChangeAdded - ключи,
+// которых в базе нет, ChangeModified - перекрытые. Удалить ключ оверлей не может, поэтому ChangeRemoved не бывает.
+// Дополнительные пути из WithVaultPaths и другие уровни не учитываются
+func (sm *SecretManagerVault) OverlayDiff(ctx context.Context) ([]KeyChange, error) {
+	if sm.overlay == nil || sm.overlay.environment == "" {
+		return nil, ErrNoOverlay
+	}
+
+	baseConfig, err := sm.readPathConfig(ctx, sm.overlay.base)
+	if err != nil {
+		return nil, err
+	}
+
+	overlayConfig, err := sm.readPathConfig(ctx, sm.kv)
+	if err != nil {
+		return nil, err
+	}
+
+	effective := maps.Clone(overlayConfig)
+	mergeConfigs(effective, baseConfig)
+
+	return DiffConfigs(baseConfig, effective), nil
+}
+
+// readPathConfig собирает конфиг одного пути KV целиком, без закреплений
+func (sm *SecretManagerVault) readPathConfig(ctx context.Context, kv kvMount) (config, error) {
+	cfg := config(make(map[string]any))
+
+	err := sm.walkSecretFoldersIn(kv, func(folder string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		folderConfig, err := sm.readFolderConfig(kv, folder)
+		mergeConfigs(cfg, folderConfig)
+
+		if err != nil && !errors.Is(err, ErrEmptyVaultResponse) {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
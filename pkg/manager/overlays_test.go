@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var overlayTestSetup = testManagerSetup{
+	mounts: map[string]int{"kv": KVVersion2},
+	secrets: map[string]map[string]any{
+		"kv/app/base/db":             {"db_host": "db.base", "db_port": 5432, "log_level": "info"},
+		"kv/app/overlays/staging/db": {"db_host": "db.staging", "debug": true},
+		"kv/app/overlays/prod/db":    {"db_host": "db.prod"},
+	},
+	options: []Option{WithMount("kv", "app")},
+}
+
+func TestOverlays(t *testing.T) {
+	fv, sm := newTestManager(t, overlayTestSetup, WithOverlays("staging"))
+
+	// оверлей сильнее базы, чужие оверлеи не грузятся
+	assert.Equal(t, config{
+		"db_host":   "db.staging",
+		"db_port":   json.Number("5432"),
+		"debug":     true,
+		"log_level": "info",
+	}, sm.config)
+
+	assert.Equal(t, "staging", sm.Status().Environment)
+	// оверлей переопределяет базу - это не коллизия, но в Explain база видна
+	assert.Empty(t, sm.KeyCollisions())
+	assert.Empty(t, sm.Status().KeyCollisions)
+	explanation := sm.Explain("db_host")
+	require.Len(t, explanation.Shadowed, 1)
+	assert.Equal(t, vaultSource("kv/data/app/base/db"), explanation.Shadowed[0].Source)
+
+	changes, err := sm.OverlayDiff(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []KeyChange{
+		{Key: "db_host", Kind: ChangeModified, Old: "db.base", New: "db.staging"},
+		{Key: "debug", Kind: ChangeAdded, New: true},
+	}, changes)
+
+	// пишет менеджер в оверлей
+	_, err = sm.PutSecret(context.Background(), "cache", map[string]any{"ttl": "1m"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"ttl": "1m"}, fv.secretData("kv/app/overlays/staging/cache"))
+}
+
+func TestOverlaysCollisions(t *testing.T) {
+	setup := overlayTestSetup
+	setup.secrets = maps.Clone(setup.secrets)
+	setup.secrets["kv/app/overlays/staging/cache"] = map[string]any{"debug": false}
+	setup.secrets["kv/app/base/kafka"] = map[string]any{"log_level": "debug"}
+	setup.secrets["kv/common/db"] = map[string]any{"db_host": "db.common"}
+
+	_, sm := newTestManager(t, setup, WithOverlays("staging"), WithVaultPaths(VaultPath{Mount: "kv", Prefix: "common"}))
+
+	// настоящие конфликты остаются: папки одного пути между собой и чужой путь, а база под оверлеем - нет
+	assert.Equal(t, []KeyCollision{
+		{Key: "db_host", Winner: "kv/data/app/overlays/staging/db", Shadowed: []string{"kv/data/common/db"}},
+		{Key: "debug", Winner: "kv/data/app/overlays/staging/cache", Shadowed: []string{"kv/data/app/overlays/staging/db"}},
+		{Key: "log_level", Winner: "kv/data/app/base/db", Shadowed: []string{"kv/data/app/base/kafka"}},
+	}, sm.KeyCollisions())
+}
+
+func TestOverlaysRefresh(t *testing.T) {
+	fv, sm := newTestManager(t, overlayTestSetup, WithOverlays("staging"))
+
+	go sm.StartConfigUpdater(10 * time.Millisecond)
+	t.Cleanup(func() { _ = sm.StopUpdater() })
+
+	// апдейтер подхватывает изменения и в базе, и в оверлее
+	fv.putSecret("kv/app/base/db", map[string]any{"db_host": "db.base", "db_port": 5432, "log_level": "warn"})
+	fv.putSecret("kv/app/overlays/staging/db", map[string]any{"db_host": "db.staging.v2", "debug": true})
+
+	assert.Eventually(t, func() bool {
+		level, levelErr := sm.GetString("log_level")
+		host, hostErr := sm.GetString("db_host")
+		return levelErr == nil && hostErr == nil && level == "warn" && host == "db.staging.v2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOverlaysEnvironmentFromEnv(t *testing.T) {
+	t.Setenv(EnvironmentEnvVar, "prod")
+
+	fv, sm := newTestManager(t, overlayTestSetup, WithOverlays(""))
+	assert.Equal(t, "prod", sm.Environment())
+
+	host, err := sm.GetString("db_host")
+	require.NoError(t, err)
+	assert.Equal(t, "db.prod", host)
+
+	// явная опция сильнее переменной
+	sm, err = fv.newManager(WithMount("kv", "app"), WithOverlays("staging"))
+	require.NoError(t, err)
+	assert.Equal(t, "staging", sm.Environment())
+}
+
+func TestOverlaysWithoutEnvironment(t *testing.T) {
+	t.Setenv(EnvironmentEnvVar, "")
+
+	_, sm := newTestManager(t, overlayTestSetup, WithOverlays(""))
+
+	host, err := sm.GetString("db_host")
+	require.NoError(t, err)
+	assert.Equal(t, "db.base", host)
+	assert.Empty(t, sm.KeyCollisions())
+
+	_, err = sm.OverlayDiff(context.Background())
+	assert.True(t, errors.Is(err, ErrNoOverlay))
+}
+
+var invalidEnvironmentTests = []string{"staging/eu", "..", "."}
+
+func TestOverlaysInvalidEnvironment(t *testing.T) {
+	fv := overlayTestSetup.newFakeVault(t)
+
+	for _, env := range invalidEnvironmentTests {
+		t.Run(env, func(t *testing.T) {
+			_, err := fv.newManager(WithMount("kv", "app"), WithOverlays(env))
+			assert.True(t, errors.Is(err, ErrInvalidEnvironment), "got error %v", err)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// EnvOverrides - какие переменные окружения перекрывают ключи конфига
+type EnvOverrides struct {
+	// Prefix включает маппинг по префиксу: с "APP_" переменная APP_DB_PASSWORD перекрывает ключ db_password.
+	// Пустой префикс - только явные Mappings
+	Prefix string
+
+	// Mappings - явный маппинг имя переменной -> ключ, например "PGPASSWORD" -> "db.password".
+	// Ключ может быть путем, как в Get. Если с префиксом выходит тот же ключ, побеждает явный маппинг
+	Mappings map[string]string
+}
+
+// ConfigOverride - ключ, значение которого берется не из vault'a, и откуда именно, например "env APP_DB_PASSWORD"
+type ConfigOverride struct {
+	Key    string
+	Source string
+}
+
+// SetEnvOverrides читает переменные окружения и кладет их поверх конфига из vault'a на LevelOverrides.
+// Окружение читается один раз при вызове, пустые переменные не считаются. Значения всегда строки, поэтому
+// для перекрытых ключей геттеры работают в мягком режиме, как с Lenient(). Повторный вызов заменяет все перекрытия
+// из окружения, SetEnvOverrides(EnvOverrides{}) их убирает. Для нескольких наборов переменных есть AddSource с EnvSource
+func (sm *SecretManagerVault) SetEnvOverrides(overrides EnvOverrides) error {
+	changed, err := sm.setEnvOverrides(overrides)
+	if changed {
+		sm.notifyChange()
+	}
+
+	return err
+}
+
+// setEnvOverrides - SetEnvOverrides без уведомления, для опций при создании менеджера
+func (sm *SecretManagerVault) setEnvOverrides(overrides EnvOverrides) (bool, error) {
+	layer, err := sm.loadLayer(context.Background(), LevelOverrides, EnvSource(overrides))
+	if err != nil {
+		return false, err
+	}
+
+	sm.Lock()
+
+	var previous config
+	position := slices.Index(sm.layers, sm.envLayer)
+	if position >= 0 {
+		previous = sm.envLayer.values
+		sm.layers = slices.Delete(sm.layers, position, position+1)
+	}
+
+	sm.envLayer = nil
+	if len(layer.values) > 0 {
+		// перекрытия из окружения слабее всего остального на своем уровне, например флагов
+		position = sort.Search(len(sm.layers), func(i int) bool {
+			return sm.layers[i].level >= LevelOverrides
+		})
+		sm.layers = slices.Insert(sm.layers, position, layer)
+		sm.envLayer = layer
+	}
+
+	sm.Unlock()
+
+	for key := range layer.values {
+		sm.logger.Warn("Config key overridden", "key", key, "source", layer.origin(key))
+	}
+
+	return areConfigsDifferent(previous, layer.values), nil
+}
+
+// Overrides - ключи, которые берутся с уровня LevelOverrides, отсортированные по ключу.
+// Значения не отдаются, это могут быть секреты
+func (sm *SecretManagerVault) Overrides() []ConfigOverride {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	return sm.overridesLocked()
+}
+
+func (sm *SecretManagerVault) overridesLocked() []ConfigOverride {
+	var overrides []ConfigOverride
+	seen := make(map[string]struct{})
+
+	sm.eachLayerLocked(func(layer configLayer) bool {
+		if layer.level != LevelOverrides {
+			return false
+		}
+
+		for key := range layer.values {
+			if _, exists := seen[key]; !exists {
+				seen[key] = struct{}{}
+				overrides = append(overrides, ConfigOverride{Key: key, Source: layer.origin(key)})
+			}
+		}
+		return true
+	})
+
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Key < overrides[j].Key
+	})
+
+	return overrides
+}
+
+type envSource struct {
+	overrides EnvOverrides
+}
+
+// EnvSource - переменные окружения по правилам EnvOverrides, обычно на LevelOverrides
+func EnvSource(overrides EnvOverrides) Source {
+	return envSource{overrides: overrides}
+}
+
+func (s envSource) Name() string {
+	return "env"
+}
+
+func (s envSource) stringValues() bool {
+	return true
+}
+
+func (s envSource) Load(ctx context.Context) (map[string]any, error) {
+	values, _, err := s.loadWithOrigins(ctx)
+	return values, err
+}
+
+func (s envSource) loadWithOrigins(context.Context) (map[string]any, map[string]string, error) {
+	values, origins := envOverrideValues(s.overrides, os.Environ())
+	return values, origins, nil
+}
+
+// envOverrideValues собирает перекрытия из окружения вида "NAME=value"
+func envOverrideValues(overrides EnvOverrides, environ []string) (config, map[string]string) {
+	env := make(map[string]string, len(environ))
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok && value != "" {
+			env[name] = value
+		}
+	}
+
+	values := make(config)
+	sources := make(map[string]string)
+
+	if overrides.Prefix != "" {
+		for name, value := range env {
+			key := strings.ToLower(strings.TrimPrefix(name, overrides.Prefix))
+			if !strings.HasPrefix(name, overrides.Prefix) || key == "" {
+				continue
+			}
+			values[key], sources[key] = value, "env "+name
+		}
+	}
+
+	for name, key := range overrides.Mappings {
+		if value, ok := env[name]; ok && key != "" {
+			values[key], sources[key] = value, "env "+name
+		}
+	}
+
+	return values, sources
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var envOverrideValuesTests = []struct {
+	name      string
+	overrides EnvOverrides
+	environ   []string
+	want      config
+	sources   map[string]string
+}{
+	{
+		name:      "prefix",
+		overrides: EnvOverrides{Prefix: "APP_"},
+		environ:   []string{"APP_DB_PASSWORD=secret", "DB_USER=ignored", "APP_=ignored", "APP_EMPTY="},
+		want:      config{"db_password": "secret"},
+		sources:   map[string]string{"db_password": "env APP_DB_PASSWORD"},
+	},
+	{
+		name:      "explicit mappings",
+		overrides: EnvOverrides{Mappings: map[string]string{"PGPASSWORD": "db.password", "MISSING": "missing"}},
+		environ:   []string{"PGPASSWORD=secret", "DB_PASSWORD=ignored"},
+		want:      config{"db.password": "secret"},
+		sources:   map[string]string{"db.password": "env PGPASSWORD"},
+	},
+	{
+		name:      "explicit mapping wins over prefix",
+		overrides: EnvOverrides{Prefix: "APP_", Mappings: map[string]string{"PGPASSWORD": "db_password"}},
+		environ:   []string{"APP_DB_PASSWORD=from-prefix", "PGPASSWORD=from-mapping"},
+		want:      config{"db_password": "from-mapping"},
+		sources:   map[string]string{"db_password": "env PGPASSWORD"},
+	},
+	{
+		name:      "value with equals sign",
+		overrides: EnvOverrides{Prefix: "APP_"},
+		environ:   []string{"APP_DSN=postgres://u:p@h/db?sslmode=disable"},
+		want:      config{"dsn": "postgres://u:p@h/db?sslmode=disable"},
+		sources:   map[string]string{"dsn": "env APP_DSN"},
+	},
+}
+
+func TestEnvOverrideValues(t *testing.T) {
+	for _, test := range envOverrideValuesTests {
+		t.Run(test.name, func(t *testing.T) {
+			values, sources := envOverrideValues(test.overrides, test.environ)
+			assert.Equal(t, test.want, values)
+			assert.Equal(t, test.sources, sources)
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	t.Setenv("VCM_TEST_DB_PASSWORD", "from-env")
+	t.Setenv("VCM_TEST_DB_PORT", "5433")
+	t.Setenv("VCM_TEST_POOL", `{"size": 10}`)
+	require.NoError(t, sm.SetJSONKeys("pool"))
+	require.NoError(t, sm.SetEnvOverrides(EnvOverrides{Prefix: "VCM_TEST_"}))
+
+	select {
+	case <-sm.GetNotifierChannel():
+	default:
+		t.Fatal("expected change notification after overrides changed")
+	}
+
+	password, err := sm.GetSecretStringFromConfig("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+
+	// значения из окружения - строки, разбираются без Lenient()
+	port, err := sm.GetInt("db_port")
+	require.NoError(t, err)
+	assert.Equal(t, 5433, port)
+
+	size, err := sm.GetInt("pool.size")
+	require.NoError(t, err)
+	assert.Equal(t, 10, size)
+
+	// vault'овский конфиг не трогается, перекрытие переживает обновление
+	assert.Equal(t, "old", sm.config["db_password"])
+	require.NoError(t, sm.ReloadConfig())
+	password, err = sm.GetString("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+
+	status := sm.Status()
+	assert.Equal(t, []ConfigOverride{
+		{Key: "db_password", Source: "env VCM_TEST_DB_PASSWORD"},
+		{Key: "db_port", Source: "env VCM_TEST_DB_PORT"},
+		{Key: "pool", Source: "env VCM_TEST_POOL"},
+	}, status.Overrides)
+
+	var dump bytes.Buffer
+	require.NoError(t, sm.DebugDump(&dump))
+	assert.Equal(t, `KEY          SOURCE
+brokers      vault kv/data/main/kafka
+db_password  env VCM_TEST_DB_PASSWORD (overrides vault kv/data/main/db)
+db_port      env VCM_TEST_DB_PORT
+db_user      vault kv/data/main/db
+pool         env VCM_TEST_POOL
+`, dump.String())
+	assert.NotContains(t, dump.String(), "from-env")
+
+	require.NoError(t, sm.SetEnvOverrides(EnvOverrides{}))
+	password, err = sm.GetString("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "old", password)
+	assert.Empty(t, sm.Status().Overrides)
+}
+
+func TestEnvOverridesPath(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	sm.config["db"] = map[string]any{"password": "nested"}
+
+	t.Setenv("VCM_TEST_PGPASSWORD", "from-env")
+	require.NoError(t, sm.SetEnvOverrides(EnvOverrides{Mappings: map[string]string{"VCM_TEST_PGPASSWORD": "db.password"}}))
+
+	password, err := sm.GetString("db.password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+}
+
+func TestEnvOverridesInvalidJSON(t *testing.T) {
+	fv := newFakeVault(t)
+	t.Setenv("VCM_TEST_POOL", "{broken")
+
+	_, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithJSONKeys("pool"),
+		WithEnvOverrides(EnvOverrides{Prefix: "VCM_TEST_"}),
+	)
+	assert.True(t, errors.Is(err, ErrInvalidJSONValue), "got error %v", err)
+}
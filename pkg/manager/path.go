@@ -0,0 +1,296 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPath      = errors.New("invalid config path")
+	ErrInvalidJSONValue = errors.New("value declared as json is not valid json")
+)
+
+// pathSegment - один шаг пути: либо ключ объекта, либо индекс массива
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath разбирает пути вида "kafka.brokers[0].host" на сегменты
+func parsePath(path string) ([]pathSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+
+	segments := make([]pathSegment, 0, 4)
+	var keyBuilder strings.Builder
+	afterIndex := false
+
+	flushKey := func(pos int) error {
+		if keyBuilder.Len() == 0 {
+			return fmt.Errorf("%w: empty key at position %d in %q", ErrInvalidPath, pos, path)
+		}
+		segments = append(segments, pathSegment{key: keyBuilder.String()})
+		keyBuilder.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '.':
+			if afterIndex {
+				afterIndex = false
+				continue
+			}
+			if err := flushKey(i); err != nil {
+				return nil, err
+			}
+		case '[':
+			if !afterIndex {
+				if err := flushKey(i); err != nil {
+					return nil, err
+				}
+			}
+
+			closing := strings.IndexByte(path[i:], ']')
+			if closing < 0 {
+				return nil, fmt.Errorf("%w: unclosed '[' at position %d in %q", ErrInvalidPath, i, path)
+			}
+
+			// только цифры: Atoi сам по себе пропустил бы "+1" и "-0"
+			rawIndex := path[i+1 : i+closing]
+			index, err := strconv.Atoi(rawIndex)
+			if err != nil || strings.TrimLeft(rawIndex, "0123456789") != "" {
+				return nil, fmt.Errorf("%w: bad index %q in %q", ErrInvalidPath, rawIndex, path)
+			}
+
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			i += closing
+			afterIndex = true
+		default:
+			if afterIndex {
+				return nil, fmt.Errorf("%w: expected '.' or '[' at position %d in %q", ErrInvalidPath, i, path)
+			}
+			keyBuilder.WriteByte(path[i])
+		}
+	}
+
+	if !afterIndex {
+		if err := flushKey(len(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	return segments, nil
+}
+
+// lookupPath ищет значение по пути. Если в конфиге есть ключ, совпадающий с путем целиком (например "db.password"),
+// то он побеждает, и по вложенным значениям мы уже не идем. Второе значение - ключ пришел из строкового источника
+func (sm *SecretManagerVault) lookupPath(path string) (any, bool, error) {
+	if value, fromStrings, exists := sm.valueLocked(path); exists {
+		return value, fromStrings, nil
+	}
+
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// parsePath не дает пути начаться с '[', так что первый сегмент - всегда ключ
+	current, fromStrings, exists := sm.valueLocked(segments[0].key)
+	if !exists {
+		return nil, false, fmt.Errorf("%w: %q", ErrKeyNotFound, path)
+	}
+
+	for _, segment := range segments[1:] {
+		switch node := current.(type) {
+		case map[string]any:
+			if segment.isIndex {
+				return nil, false, fmt.Errorf("%w: %q indexes an object", ErrInvalidPath, path)
+			}
+			if current, exists = node[segment.key]; !exists {
+				return nil, false, fmt.Errorf("%w: %q", ErrKeyNotFound, path)
+			}
+		case []any:
+			if !segment.isIndex {
+				return nil, false, fmt.Errorf("%w: %q uses a key on an array", ErrInvalidPath, path)
+			}
+			if segment.index >= len(node) {
+				return nil, false, fmt.Errorf("%w: %q", ErrKeyNotFound, path)
+			}
+			current = node[segment.index]
+		default:
+			return nil, false, fmt.Errorf("%w: %q goes through a scalar value", ErrKeyNotFound, path)
+		}
+	}
+
+	return current, fromStrings, nil
+}
+
+// lookupPathWithOptions достает значение и итоговые настройки вызова под одной блокировкой
+func (sm *SecretManagerVault) lookupPathWithOptions(path string, opts []GetOption) (any, getOptions, error) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	value, fromStrings, err := sm.lookupPath(path)
+	return value, buildGetOptions(sm.lenientConversion || fromStrings, opts), err
+}
+
+// SetJSONKeys объявляет ключи, строковые значения которых содержат JSON. Такие значения разбираются при загрузке
+// в ту же структуру, по которой ходят Get* по пути. Уже загруженные значения разбираются сразу
+func (sm *SecretManagerVault) SetJSONKeys(keys ...string) error {
+	sm.Lock()
+	defer sm.Unlock()
+
+	sm.jsonKeys = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		sm.jsonKeys[key] = struct{}{}
+	}
+
+	var errToReturn error
+	for key := range sm.jsonKeys {
+		value, exists := sm.config[key]
+		if !exists {
+			continue
+		}
+
+		decoded, err := sm.decodeJSONValueLocked(key, value)
+		if err != nil {
+			errToReturn = errors.Join(errToReturn, err)
+			continue
+		}
+		sm.config[key] = decoded
+	}
+
+	for _, layer := range sm.layers {
+		for key := range sm.jsonKeys {
+			value, exists := layer.values[key]
+			if !exists {
+				continue
+			}
+
+			decoded, err := sm.decodeJSONValueLocked(key, value)
+			if err != nil {
+				errToReturn = errors.Join(errToReturn, fmt.Errorf("%s: %w", layer.origin(key), err))
+				continue
+			}
+			layer.values[key] = decoded
+		}
+	}
+
+	return errToReturn
+}
+
+func (sm *SecretManagerVault) decodeJSONValue(key string, value any) (any, error) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	return sm.decodeJSONValueLocked(key, value)
+}
+
+func (sm *SecretManagerVault) decodeJSONValueLocked(key string, value any) (any, error) {
+	if _, declared := sm.jsonKeys[key]; !declared {
+		return value, nil
+	}
+
+	str, isString := value.(string)
+	if !isString {
+		return value, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(str))
+	decoder.UseNumber() // числа внутри получают ту же обработку без потерь, что и значения верхнего уровня
+
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return value, fmt.Errorf("%w: key %q: %w", ErrInvalidJSONValue, key, err)
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return value, fmt.Errorf("%w: key %q: trailing data", ErrInvalidJSONValue, key)
+	}
+
+	return decoded, nil
+}
+
+// deepCopyValue копирует вложенные объекты и массивы, чтобы наружу не утекали ссылки на внутренний конфиг
+func deepCopyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for k, inner := range v {
+			copied[k] = deepCopyValue(inner)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, inner := range v {
+			copied[i] = deepCopyValue(inner)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// Get возвращает значение по пути вида "kafka.brokers[0]". Объекты и массивы возвращаются копией
+func (sm *SecretManagerVault) Get(path string) (any, error) {
+	return getPath(sm, path, nil, func(value any, _ bool) (any, error) {
+		return deepCopyValue(value), nil
+	})
+}
+
+// getPath - общая часть Get*: поиск по пути и приведение типа. Ошибки пишутся в лог так же, как в GetSecret*FromConfig:
+// отсутствующий ключ - нет, сломанный путь и неудачное приведение - да
+func getPath[T any](sm *SecretManagerVault, path string, opts []GetOption, convert func(value any, lenient bool) (T, error)) (T, error) {
+	var zero T
+
+	value, o, err := sm.lookupPathWithOptions(path, opts)
+	if err != nil {
+		if !errors.Is(err, ErrKeyNotFound) {
+			sm.logger.Error("Error looking up config path", "path", path, "error", err)
+		}
+		return zero, err
+	}
+
+	converted, err := convert(value, o.lenient)
+	if err != nil {
+		sm.logger.Error("Error reading secret from config", "path", path, "error", err)
+		return zero, err
+	}
+
+	return converted, nil
+}
+
+func (sm *SecretManagerVault) GetString(path string, opts ...GetOption) (string, error) {
+	return getPath(sm, path, opts, toString)
+}
+
+func (sm *SecretManagerVault) GetBool(path string, opts ...GetOption) (bool, error) {
+	return getPath(sm, path, opts, toBool)
+}
+
+func (sm *SecretManagerVault) GetInt(path string, opts ...GetOption) (int, error) {
+	return getPath(sm, path, opts, toInt)
+}
+
+func (sm *SecretManagerVault) GetInt64(path string, opts ...GetOption) (int64, error) {
+	return getPath(sm, path, opts, func(value any, lenient bool) (int64, error) {
+		return toInt64(value, lenient, ErrWhileConvertingToInt64)
+	})
+}
+
+func (sm *SecretManagerVault) GetUint64(path string, opts ...GetOption) (uint64, error) {
+	return getPath(sm, path, opts, func(value any, lenient bool) (uint64, error) {
+		return toUint64(value, lenient, ErrWhileConvertingToUint64)
+	})
+}
+
+func (sm *SecretManagerVault) GetFloat64(path string, opts ...GetOption) (float64, error) {
+	return getPath(sm, path, opts, toFloat64)
+}
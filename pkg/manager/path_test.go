@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var parsePathTests = []struct {
+	path        string
+	expected    []pathSegment
+	expectedErr error
+}{
+	{"kafka", []pathSegment{{key: "kafka"}}, nil},
+	{"kafka.brokers[0]", []pathSegment{{key: "kafka"}, {key: "brokers"}, {index: 0, isIndex: true}}, nil},
+	{"a[1][2].b", []pathSegment{{key: "a"}, {index: 1, isIndex: true}, {index: 2, isIndex: true}, {key: "b"}}, nil},
+	{"", nil, ErrInvalidPath},
+	{"a..b", nil, ErrInvalidPath},
+	{"a.", nil, ErrInvalidPath},
+	{"a[x]", nil, ErrInvalidPath},
+	{"a[0", nil, ErrInvalidPath},
+	{"a[0]b", nil, ErrInvalidPath},
+	{"a[+1]", nil, ErrInvalidPath},
+	{"a[-0]", nil, ErrInvalidPath},
+	{"a[ 1]", nil, ErrInvalidPath},
+	{"[0]", nil, ErrInvalidPath},
+}
+
+func TestParsePath(t *testing.T) {
+	for _, test := range parsePathTests {
+		t.Run(test.path, func(t *testing.T) {
+			segments, err := parsePath(test.path)
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.Equal(t, test.expected, segments)
+		})
+	}
+}
+
+// decodeLikeVault разбирает JSON так же, как клиент vault'a, - с json.Number внутри
+func decodeLikeVault(t *testing.T, raw string) map[string]any {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+
+	var out map[string]any
+	require.NoError(t, decoder.Decode(&out))
+	return out
+}
+
+func TestGetByPath(t *testing.T) {
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	sm.config = decodeLikeVault(t, `{
+		"kafka": {"brokers": ["b1:9092", "b2:9092"], "partitions": 9007199254740993},
+		"db.password": "dotted",
+		"flags": [true, false]
+	}`)
+
+	broker, err := sm.GetString("kafka.brokers[1]")
+	assert.NoError(t, err)
+	assert.Equal(t, "b2:9092", broker)
+
+	partitions, err := sm.GetInt64("kafka.partitions")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), partitions)
+
+	dotted, err := sm.GetString("db.password")
+	assert.NoError(t, err)
+	assert.Equal(t, "dotted", dotted)
+
+	flag, err := sm.GetBool("flags[0]")
+	assert.NoError(t, err)
+	assert.True(t, flag)
+
+	_, err = sm.GetString("kafka.brokers[5]")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+
+	_, err = sm.GetString("kafka[0]")
+	assert.True(t, errors.Is(err, ErrInvalidPath))
+
+	brokers, err := sm.Get("kafka.brokers")
+	require.NoError(t, err)
+	brokers.([]any)[0] = "mutated"
+	broker, _ = sm.GetString("kafka.brokers[0]")
+	assert.Equal(t, "b1:9092", broker)
+}
+
+func TestSetJSONKeys(t *testing.T) {
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	sm.config = config{
+		"kafka":  `{"brokers": ["b1:9092"], "retries": 12345678901234567}`,
+		"broken": `{"brokers": [`,
+	}
+
+	require.NoError(t, sm.SetJSONKeys("kafka"))
+
+	broker, err := sm.GetString("kafka.brokers[0]")
+	assert.NoError(t, err)
+	assert.Equal(t, "b1:9092", broker)
+
+	retries, err := sm.GetInt64("kafka.retries")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12345678901234567), retries)
+
+	err = sm.SetJSONKeys("kafka", "broken")
+	assert.True(t, errors.Is(err, ErrInvalidJSONValue))
+}
+
+func TestGetByPathLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	sm, _ := NewSecretManagerWithOptions(WithToken(testVaultToken), WithBasePaths(testBasePathData, testBasePathMetadata), WithLogger(logger))
+	sm.config = config{"db_port": "not a number"}
+	buf.Reset()
+
+	// отсутствующий ключ в лог не пишется, как и в GetSecret*FromConfig
+	_, err := sm.GetInt("missing")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	assert.Empty(t, buf.String())
+
+	_, err = sm.GetInt("db_port")
+	assert.True(t, errors.Is(err, ErrWhileConvertingToInt))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "db_port", entry["path"])
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.NotContains(t, buf.String(), "not a number")
+
+	buf.Reset()
+	_, err = sm.GetString("db_port[")
+	assert.True(t, errors.Is(err, ErrInvalidPath))
+	assert.Contains(t, buf.String(), `"path":"db_port["`)
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinFolder(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+
+	fv.putSecret("kv/main/db", map[string]any{"db_user": "app", "db_password": "experimental"})
+
+	require.NoError(t, sm.PinFolder("db/", 1, time.Minute))
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "old", sm.config["db_password"])
+
+	value, err := sm.UpdateSpecificSecret("db", "db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "old", value)
+
+	pins := sm.Status().PinnedFolders
+	require.Len(t, pins, 1)
+	assert.Equal(t, "db", pins[0].Folder)
+	assert.Equal(t, 1, pins[0].Version)
+
+	// запись с UpdateLocalConfig не сдвигает закрепленную папку в конфиге
+	_, err = sm.PatchSecret(context.Background(), "db", map[string]any{"db_password": "newer"}, UpdateLocalConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "old", sm.config["db_password"])
+
+	sm.UnpinFolder("db")
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "newer", sm.config["db_password"])
+	assert.Empty(t, sm.Status().PinnedFolders)
+}
+
+func TestPinExpires(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "v1"})
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "v2"})
+
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithMount("kv", "main"),
+		WithPinnedVersion("db", 1, 50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "v1", sm.config["db_password"])
+
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "v2", sm.config["db_password"])
+	assert.Empty(t, sm.PinnedFolders())
+}
+
+var pinFolderErrorsTests = []struct {
+	name        string
+	kvVersion   int
+	version     int
+	expectedErr error
+}{
+	{"kv v1", KVVersion1, 1, ErrVersionsNotSupported},
+	{"zero version", KVVersion2, 0, ErrInvalidVersion},
+}
+
+func TestPinFolderErrors(t *testing.T) {
+	for _, test := range pinFolderErrorsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, sm := newTestManager(t, writeTestSetup.withKVVersion(test.kvVersion))
+
+			err := sm.PinFolder("db", test.version, time.Minute)
+			assert.True(t, errors.Is(err, test.expectedErr))
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSealWatcherStarted - StartSealWatcher уже вызывали на этом менеджере
+var ErrSealWatcherStarted = errors.New("seal watcher already started")
+
+type SealEventType int
+
+const (
+	// SealEventSealed - vault оказался запечатан (в том числе при первой проверке)
+	SealEventSealed SealEventType = iota + 1
+	// SealEventUnsealed - vault снова распечатан, сам или нашими ключами
+	SealEventUnsealed
+	// SealEventUnsealFailed - автоматическое распечатывание не удалось, Err содержит причину
+	SealEventUnsealFailed
+	// SealEventCheckFailed - не удалось узнать состояние печати, например vault недоступен
+	SealEventCheckFailed
+)
+
+func (t SealEventType) String() string {
+	switch t {
+	case SealEventSealed:
+		return "sealed"
+	case SealEventUnsealed:
+		return "unsealed"
+	case SealEventUnsealFailed:
+		return "unseal_failed"
+	case SealEventCheckFailed:
+		return "check_failed"
+	default:
+		return "unknown"
+	}
+}
+
+type SealEvent struct {
+	Type     SealEventType
+	Progress UnsealProgress
+	Err      error
+	At       time.Time
+}
+
+// SealWatcherOptions - настройки StartSealWatcher
+type SealWatcherOptions struct {
+	// Interval - как часто опрашивать sys/seal-status, по умолчанию DefaultSealCheckInterval
+	Interval time.Duration
+
+	// Keys - откуда брать ключи для автоматического распечатывания. Без них вотчер только следит и сообщает
+	Keys UnsealKeySource
+
+	// ResetBeforeUnseal сбрасывает чужой частичный прогресс перед тем, как кормить свои ключи
+	ResetBeforeUnseal bool
+}
+
+// SealEvents - канал с переходами печати. Закрывается, когда вотчер останавливается.
+// Отправка неблокирующая: если никто не читает, события теряются
+func (sm *SecretManagerVault) SealEvents() <-chan SealEvent {
+	return sm.sealEvents
+}
+
+// StartSealWatcher блокирующе следит за печатью vault'a, запускать в отдельной горутине.
+// Пока vault запечатан, апдейтер конфига пропускает обновления. Если переданы ключи, вотчер сам
+// распечатывает vault - это для dev и on-prem стендов, где после рестарта его некому распечатать.
+// Останавливается вместе с апдейтером через StopUpdater. Запускается один раз на менеджер: канал SealEvents
+// закрывается при остановке, поэтому повторный вызов сразу возвращает ErrSealWatcherStarted
+func (sm *SecretManagerVault) StartSealWatcher(opts SealWatcherOptions) error {
+	if !sm.markSealWatcherStarted() {
+		return ErrSealWatcherStarted
+	}
+	defer close(sm.sealEvents)
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultSealCheckInterval
+	}
+
+	defer sm.setSealWatcherRunning(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sm.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	known := false
+	for {
+		sealed, checked := sm.checkSeal(ctx)
+		if checked {
+			if !known || sealed != sm.isSealed() {
+				sm.setSealed(sealed)
+				if sealed {
+					sm.emitSealEvent(SealEvent{Type: SealEventSealed})
+				} else if known {
+					sm.emitSealEvent(SealEvent{Type: SealEventUnsealed})
+				}
+			}
+			known = true
+
+			if sealed && opts.Keys != nil {
+				sm.autoUnseal(ctx, opts)
+			}
+		}
+
+		select {
+		case <-sm.stopChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSeal узнает состояние печати. checked=false, если vault не ответил
+func (sm *SecretManagerVault) checkSeal(ctx context.Context) (sealed bool, checked bool) {
+	progress, err := sm.SealStatus(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			sm.logger.Warn("Error checking seal status", "error", err)
+			sm.emitSealEvent(SealEvent{Type: SealEventCheckFailed, Err: err})
+		}
+		return false, false
+	}
+
+	sm.stateMu.Lock()
+	sm.state.sealCheckedAt = time.Now()
+	sm.stateMu.Unlock()
+
+	return progress.Sealed, true
+}
+
+func (sm *SecretManagerVault) autoUnseal(ctx context.Context, opts SealWatcherOptions) {
+	startedAt := time.Now()
+	progress, err := sm.Unseal(ctx, opts.Keys, UnsealOptions{Reset: opts.ResetBeforeUnseal})
+	if err != nil && !errors.Is(err, ErrAlreadyUnsealed) {
+		if ctx.Err() == nil {
+			sm.logger.Error("Automatic unseal failed", "duration", time.Since(startedAt), "error", err)
+			sm.emitSealEvent(SealEvent{Type: SealEventUnsealFailed, Progress: progress, Err: err})
+		}
+		return
+	}
+
+	sm.logger.Info("Vault unsealed automatically", "duration", time.Since(startedAt))
+	sm.setSealed(false)
+	sm.emitSealEvent(SealEvent{Type: SealEventUnsealed, Progress: progress})
+}
+
+func (sm *SecretManagerVault) emitSealEvent(event SealEvent) {
+	event.At = time.Now()
+
+	select {
+	case sm.sealEvents <- event:
+	default:
+		sm.logger.Info("Seal events channel blocked, cant send event", "event", event.Type.String())
+	}
+}
+
+func (sm *SecretManagerVault) isSealed() bool {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	return sm.state.sealed
+}
+
+func (sm *SecretManagerVault) setSealed(sealed bool) {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	sm.state.sealed = sealed
+}
+
+// markSealWatcherStarted отмечает запуск вотчера, false - его уже запускали
+func (sm *SecretManagerVault) markSealWatcherStarted() bool {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	if sm.state.sealWatcherStarted {
+		return false
+	}
+
+	sm.state.sealWatcherStarted = true
+	sm.state.sealWatcherRunning = true
+	return true
+}
+
+func (sm *SecretManagerVault) setSealWatcherRunning(running bool) {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	sm.state.sealWatcherRunning = running
+}
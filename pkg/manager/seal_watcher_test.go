@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitSealEvent(t *testing.T, events <-chan SealEvent) SealEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for seal event")
+		return SealEvent{}
+	}
+}
+
+func TestSealWatcherAutoUnseal(t *testing.T) {
+	fv := newFakeVault(t)
+	seal := fv.enableSeal(testUnsealKeys, 3)
+
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	go sm.StartSealWatcher(SealWatcherOptions{Interval: 20 * time.Millisecond, Keys: StaticUnsealKeys(testUnsealKeys)})
+	t.Cleanup(func() { _ = sm.StopUpdater() })
+
+	assert.Equal(t, SealEventSealed, waitSealEvent(t, sm.SealEvents()).Type)
+	unsealed := waitSealEvent(t, sm.SealEvents())
+	assert.Equal(t, SealEventUnsealed, unsealed.Type)
+	assert.False(t, unsealed.Progress.Sealed)
+	assert.False(t, seal.isSealed())
+
+	seal.seal()
+	assert.Equal(t, SealEventSealed, waitSealEvent(t, sm.SealEvents()).Type)
+	assert.Equal(t, SealEventUnsealed, waitSealEvent(t, sm.SealEvents()).Type)
+
+	status := sm.Status()
+	assert.True(t, status.SealWatcherRunning)
+	assert.False(t, status.Sealed)
+	assert.False(t, status.SealCheckedAt.IsZero())
+}
+
+func TestSealWatcherPausesUpdater(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.enableSeal(testUnsealKeys, 3)
+
+	var lists atomic.Int32
+	fv.handle("kv/metadata/main/", func(r *fakeRequest) any {
+		lists.Add(1)
+		return map[string]any{"data": map[string]any{"keys": []any{}}}
+	})
+
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	go sm.StartSealWatcher(SealWatcherOptions{Interval: 10 * time.Millisecond})
+	assert.Equal(t, SealEventSealed, waitSealEvent(t, sm.SealEvents()).Type)
+
+	go sm.StartConfigUpdater(10 * time.Millisecond)
+	t.Cleanup(func() { _ = sm.StopUpdater() })
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), lists.Load())
+
+	status := sm.Status()
+	assert.True(t, status.Sealed)
+	assert.True(t, status.RefreshPaused)
+}
+
+func TestSealWatcherStartTwice(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableSeal(testUnsealKeys, 3)
+
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- sm.StartSealWatcher(SealWatcherOptions{Interval: 10 * time.Millisecond}) }()
+	assert.Equal(t, SealEventSealed, waitSealEvent(t, sm.SealEvents()).Type)
+
+	assert.True(t, errors.Is(sm.StartSealWatcher(SealWatcherOptions{}), ErrSealWatcherStarted))
+
+	require.NoError(t, sm.StopUpdater())
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("seal watcher did not stop")
+	}
+	assert.False(t, sm.Status().SealWatcherRunning)
+
+	// повторный запуск после остановки не трогает уже закрытый канал
+	assert.True(t, errors.Is(sm.StartSealWatcher(SealWatcherOptions{}), ErrSealWatcherStarted))
+}
@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"time"
 )
 
@@ -8,6 +9,9 @@ type config map[string]any
 
 const (
 	DefaultConfigUpdateInterval = 5 * time.Minute
+	DefaultSealCheckInterval    = 10 * time.Second
+
+	sealEventsBufferSize = 16
 )
 
 const (
@@ -16,13 +20,18 @@ const (
 
 	// DefaultBasePathMetaData - дефолтный путь до подпапок с секретами в папке.
 	DefaultBasePathMetaData = "kv/metadata/"
+
+	// DefaultMount - дефолтное имя маунта KV для NewSecretManagerForMount.
+	DefaultMount = "kv"
 )
 
-type logger interface {
-	Errorf(format string, args ...interface{})
-	Infof(format string, args ...interface{})
-	Debugf(format string, args ...interface{})
-	Fatalf(format string, args ...interface{})
+// Logger - структурированный логгер: сообщение и дальше пары ключ-значение, как в log/slog.
+// *slog.Logger подходит без адаптеров, для zap есть NewZapLogger, для тишины - NewNopLogger
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
 }
 
 type SecretManager interface {
@@ -36,6 +45,24 @@ type SecretManager interface {
 	GetSecretFloat64FromConfig(key string) (float64, error)
 	StartConfigUpdater(updateInterval time.Duration)
 	GetNotifierChannel() <-chan struct{}
-	UnsealVault(unsealKeys []string)
+	UnsealVault(unsealKeys []string) error
 	StopUpdater() error
 }
+
+// SecretWriter - запись в KV. Вынесен из SecretManager, чтобы не ломать его существующие реализации
+type SecretWriter interface {
+	PutSecret(ctx context.Context, folder string, data map[string]any, opts ...WriteOption) (int, error)
+	PatchSecret(ctx context.Context, folder string, patch map[string]any, opts ...WriteOption) (int, error)
+	DeleteSecret(ctx context.Context, folder string, opts ...WriteOption) error
+}
+
+// Explainer - откуда взялось значение ключа и какие источники оно перекрыло
+type Explainer interface {
+	Explain(key string) KeyExplanation
+}
+
+var (
+	_ SecretManager = (*SecretManagerVault)(nil)
+	_ SecretWriter  = (*SecretManagerVault)(nil)
+	_ Explainer     = (*SecretManagerVault)(nil)
+)
@@ -0,0 +1,510 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidSourceLevel    = errors.New("invalid config source level")
+	ErrUnsupportedFileFormat = errors.New("unsupported config file format")
+	ErrInvalidConfigFile     = errors.New("invalid config file")
+	ErrNilConfigSource       = errors.New("config source is nil")
+)
+
+// SourceLevel - уровень источника конфига. Чем выше уровень, тем сильнее источник: ключ берется из самого сильного,
+// где он есть. Внутри одного уровня побеждает источник, добавленный позже. Ключ верхнего уровня берется целиком:
+// вложенные объекты из разных источников не сливаются, kafka из файла полностью заменяет kafka из дефолтов
+type SourceLevel int
+
+const (
+	LevelDefaults  SourceLevel = iota // встроенные значения по умолчанию
+	LevelFiles                        // локальные YAML/JSON/dotenv файлы
+	LevelVault                        // то, что загружено из vault'a, этот уровень заполняет сам менеджер
+	LevelOverrides                    // переменные окружения и флаги
+)
+
+func (l SourceLevel) String() string {
+	switch l {
+	case LevelDefaults:
+		return "defaults"
+	case LevelFiles:
+		return "files"
+	case LevelVault:
+		return "vault"
+	case LevelOverrides:
+		return "overrides"
+	default:
+		return fmt.Sprintf("SourceLevel(%d)", int(l))
+	}
+}
+
+// Source - источник конфига помимо vault'a. Load зовется при добавлении и на каждый ReloadSources,
+// значения - как из JSON: string, bool, числа, map[string]any и []any
+type Source interface {
+	Name() string
+	Load(ctx context.Context) (map[string]any, error)
+}
+
+// originSource - источник, у ключей которого разное происхождение, например разные переменные окружения
+type originSource interface {
+	loadWithOrigins(ctx context.Context) (map[string]any, map[string]string, error)
+}
+
+// stringSource - источник, который умеет отдавать только строки: окружение, флаги, dotenv. Его значения геттеры
+// разбирают как при SetLenientConversion(true), иначе "8080" из окружения не прочитать через GetInt.
+// Типизированные JSON/YAML и дефолты так не помечаются, там тип значения задан явно
+type stringSource interface {
+	stringValues() bool
+}
+
+// configLayer - загруженный источник на своем уровне
+type configLayer struct {
+	level   SourceLevel
+	name    string
+	source  Source
+	values  config
+	origins map[string]string // ключ -> происхождение, если оно точнее name
+	// stringValues - все значения пришли строками, разбирать их надо мягко
+	stringValues bool
+}
+
+func (l configLayer) origin(key string) string {
+	if origin, ok := l.origins[key]; ok {
+		return origin
+	}
+
+	return l.name
+}
+
+// KeyOrigin - один источник, в котором нашелся ключ
+type KeyOrigin struct {
+	Level  SourceLevel
+	Source string
+	Value  any
+}
+
+// KeyExplanation - откуда взят ключ и что он перекрыл. Value в KeyOrigin - настоящие значения, логировать их не стоит,
+// для логов есть String
+type KeyExplanation struct {
+	Key   string
+	Found bool
+
+	Winner KeyOrigin
+	// Shadowed - источники, где ключ тоже есть, но проиграл, от сильного к слабому
+	Shadowed []KeyOrigin
+}
+
+func (e KeyExplanation) String() string {
+	if !e.Found {
+		return e.Key + ": not found"
+	}
+
+	explanation := e.Key + ": " + e.Winner.Source
+	if len(e.Shadowed) > 0 {
+		shadowed := make([]string, 0, len(e.Shadowed))
+		for _, origin := range e.Shadowed {
+			shadowed = append(shadowed, origin.Source)
+		}
+		explanation += " (overrides " + strings.Join(shadowed, ", ") + ")"
+	}
+
+	return explanation
+}
+
+// AddSource загружает источник и добавляет его на уровень level. Если загрузить не вышло, источник не добавляется.
+// Уровень LevelVault занят самим менеджером
+func (sm *SecretManagerVault) AddSource(ctx context.Context, level SourceLevel, source Source) error {
+	changed, err := sm.addSource(ctx, level, source)
+	if changed {
+		sm.notifyChange()
+	}
+
+	return err
+}
+
+func (sm *SecretManagerVault) addSource(ctx context.Context, level SourceLevel, source Source) (bool, error) {
+	if source == nil {
+		return false, ErrNilConfigSource
+	}
+	if level == LevelVault {
+		return false, fmt.Errorf("%w: vault level is filled by the manager itself", ErrInvalidSourceLevel)
+	}
+	if level < LevelDefaults || level > LevelOverrides {
+		return false, fmt.Errorf("%w: %d", ErrInvalidSourceLevel, int(level))
+	}
+
+	layer, err := sm.loadLayer(ctx, level, source)
+	if err != nil {
+		sm.logger.Error("Error loading config source", "source", source.Name(), "error", err)
+		return false, err
+	}
+
+	sm.Lock()
+	// слои лежат по возрастанию уровня, новый встает последним на своем уровне
+	position := sort.Search(len(sm.layers), func(i int) bool {
+		return sm.layers[i].level > level
+	})
+	sm.layers = append(sm.layers, nil)
+	copy(sm.layers[position+1:], sm.layers[position:])
+	sm.layers[position] = layer
+	sm.Unlock()
+
+	sm.logger.Info("Config source added", "source", layer.name, "level", level.String(), "keys", len(layer.values))
+
+	return len(layer.values) > 0, nil
+}
+
+// ReloadSources перечитывает все источники, кроме vault'a. Если источник не загрузился, остаются его прошлые значения,
+// ошибки собираются через errors.Join
+func (sm *SecretManagerVault) ReloadSources(ctx context.Context) error {
+	sm.RLock()
+	layers := make([]*configLayer, len(sm.layers))
+	copy(layers, sm.layers)
+	sm.RUnlock()
+
+	var errToReturn error
+	changed := false
+
+	for _, layer := range layers {
+		reloaded, err := sm.loadLayer(ctx, layer.level, layer.source)
+		if err != nil {
+			sm.logger.Error("Error reloading config source, keeping previous values", "source", layer.name, "error", err)
+			errToReturn = errors.Join(errToReturn, err)
+			continue
+		}
+
+		sm.Lock()
+		if areConfigsDifferent(layer.values, reloaded.values) {
+			changed = true
+		}
+		layer.values, layer.origins = reloaded.values, reloaded.origins
+		sm.Unlock()
+	}
+
+	if changed {
+		sm.notifyChange()
+	}
+
+	return errToReturn
+}
+
+func (sm *SecretManagerVault) loadLayer(ctx context.Context, level SourceLevel, source Source) (*configLayer, error) {
+	var values map[string]any
+	var origins map[string]string
+	var err error
+
+	if withOrigins, ok := source.(originSource); ok {
+		values, origins, err = withOrigins.loadWithOrigins(ctx)
+	} else {
+		values, err = source.Load(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", source.Name(), err)
+	}
+
+	layer := &configLayer{level: level, name: source.Name(), source: source, values: make(config, len(values)), origins: origins}
+	if stringOnly, ok := source.(stringSource); ok {
+		layer.stringValues = stringOnly.stringValues()
+	}
+
+	var errToReturn error
+	for key, value := range values {
+		decoded, err := sm.decodeJSONValue(key, value)
+		if err != nil {
+			errToReturn = errors.Join(errToReturn, fmt.Errorf("%s: %w", layer.origin(key), err))
+			continue
+		}
+		layer.values[key] = decoded
+	}
+
+	if errToReturn != nil {
+		return nil, errToReturn
+	}
+
+	return layer, nil
+}
+
+// eachLayerLocked обходит слои от сильного к слабому, vault - между перекрытиями и файлами.
+// visit возвращает false, чтобы остановить обход
+func (sm *SecretManagerVault) eachLayerLocked(visit func(layer configLayer) bool) {
+	vault := configLayer{level: LevelVault, name: "vault", values: sm.config}
+	vaultVisited := false
+
+	for i := len(sm.layers) - 1; i >= 0; i-- {
+		layer := sm.layers[i]
+		if !vaultVisited && layer.level < LevelVault {
+			vaultVisited = true
+			if !visit(vault) {
+				return
+			}
+		}
+
+		if !visit(*layer) {
+			return
+		}
+	}
+
+	if !vaultVisited {
+		visit(vault)
+	}
+}
+
+// valueLocked - значение ключа верхнего уровня из самого сильного источника, где он есть.
+// fromStrings - значение пришло из источника, который умеет только строки (stringSource)
+func (sm *SecretManagerVault) valueLocked(key string) (value any, fromStrings bool, exists bool) {
+	sm.eachLayerLocked(func(layer configLayer) bool {
+		value, exists = layer.values[key]
+		fromStrings = layer.stringValues
+		return !exists
+	})
+
+	return value, fromStrings && exists, exists
+}
+
+// keysLocked - ключи верхнего уровня итогового конфига, со всех уровней
+func (sm *SecretManagerVault) keysLocked() map[string]struct{} {
+	keySet := make(map[string]struct{}, len(sm.config))
+	sm.eachLayerLocked(func(layer configLayer) bool {
+		for key := range layer.values {
+			keySet[key] = struct{}{}
+		}
+		return true
+	})
+
+	return keySet
+}
+
+// Explain показывает, из какого источника берется ключ и в каких еще он есть. Путь вида "db.password" объясняется
+// по ключу верхнего уровня, если целиком такого ключа нет
+func (sm *SecretManagerVault) Explain(key string) KeyExplanation {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	origins := sm.originsLocked(key)
+	if len(origins) == 0 {
+		if segments, err := parsePath(key); err == nil && !segments[0].isIndex && segments[0].key != key {
+			origins = sm.originsLocked(segments[0].key)
+		}
+	}
+
+	explanation := KeyExplanation{Key: key}
+	if len(origins) > 0 {
+		explanation.Found = true
+		explanation.Winner, explanation.Shadowed = origins[0], origins[1:]
+	}
+
+	return explanation
+}
+
+func (sm *SecretManagerVault) originsLocked(key string) []KeyOrigin {
+	var origins []KeyOrigin
+	sm.eachLayerLocked(func(layer configLayer) bool {
+		value, exists := layer.values[key]
+		if !exists {
+			return true
+		}
+
+		// у vault'a свои происхождения: папка-победитель и все, что она перекрыла в других папках и путях
+		if vaultOrigins := sm.vaultOrigins[key]; layer.level == LevelVault && len(vaultOrigins) > 0 {
+			origins = append(origins, KeyOrigin{Level: LevelVault, Source: vaultOrigins[0].Source, Value: deepCopyValue(value)})
+			for _, shadowed := range vaultOrigins[1:] {
+				origins = append(origins, KeyOrigin{Level: LevelVault, Source: shadowed.Source, Value: deepCopyValue(shadowed.Value)})
+			}
+			return true
+		}
+
+		origins = append(origins, KeyOrigin{Level: layer.level, Source: layer.origin(key), Value: deepCopyValue(value)})
+		return true
+	})
+
+	return origins
+}
+
+// DebugDump пишет в w все ключи из всех источников и откуда каждый взят, без значений
+func (sm *SecretManagerVault) DebugDump(w io.Writer) error {
+	sm.RLock()
+	keySet := sm.keysLocked()
+
+	explanations := make([]KeyExplanation, 0, len(keySet))
+	for key := range keySet {
+		origins := sm.originsLocked(key)
+		explanations = append(explanations, KeyExplanation{Key: key, Found: true, Winner: origins[0], Shadowed: origins[1:]})
+	}
+	sm.RUnlock()
+
+	sort.Slice(explanations, func(i, j int) bool {
+		return explanations[i].Key < explanations[j].Key
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSOURCE")
+	for _, explanation := range explanations {
+		fmt.Fprintf(tw, "%s\t%s\n", explanation.Key, strings.TrimPrefix(explanation.String(), explanation.Key+": "))
+	}
+
+	return tw.Flush()
+}
+
+type staticSource struct {
+	name   string
+	values map[string]any
+}
+
+// DefaultsSource - встроенные значения по умолчанию, обычно на LevelDefaults
+func DefaultsSource(values map[string]any) Source {
+	return staticSource{name: "defaults", values: values}
+}
+
+func (s staticSource) Name() string {
+	return s.name
+}
+
+func (s staticSource) Load(context.Context) (map[string]any, error) {
+	values := make(map[string]any, len(s.values))
+	for key, value := range s.values {
+		values[key] = deepCopyValue(value)
+	}
+
+	return values, nil
+}
+
+type fileSource struct {
+	path string
+}
+
+// FileSource - локальный файл конфига, формат по расширению: .yaml/.yml, .json или .env (и файл с именем .env).
+// В dotenv имена переменных приводятся к нижнему регистру, DB_PASSWORD -> db_password. Отсутствующий файл - ошибка
+func FileSource(path string) Source {
+	return fileSource{path: path}
+}
+
+func (s fileSource) Name() string {
+	return "file " + s.path
+}
+
+// format - расширение файла в нижнем регистре, файл с именем .env - тоже ".env"
+func (s fileSource) format() string {
+	if filepath.Base(s.path) == ".env" {
+		return ".env"
+	}
+
+	return strings.ToLower(filepath.Ext(s.path))
+}
+
+func (s fileSource) stringValues() bool {
+	return s.format() == ".env"
+}
+
+func (s fileSource) Load(context.Context) (map[string]any, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+	switch s.format() {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".env":
+		values, err = parseDotenv(content)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFileFormat, s.path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfigFile, s.path, err)
+	}
+
+	if values == nil {
+		values = make(map[string]any) // пустой файл
+	}
+
+	return values, nil
+}
+
+// parseDotenv - KEY=value по строке, # - комментарий, export в начале допускается, значения можно брать в кавычки
+func parseDotenv(content []byte) (map[string]any, error) {
+	values := make(map[string]any)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+
+		values[strings.ToLower(name)] = value
+	}
+
+	return values, scanner.Err()
+}
+
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+// FlagSource - флаги, которые явно переданы в командной строке, обычно на LevelOverrides.
+// Имя флага становится ключом с заменой "-" на "_": -db-password -> db_password. Значения по умолчанию не считаются,
+// так что флаг не перекрывает vault, пока его не передали. fs должен быть уже разобран
+func FlagSource(fs *flag.FlagSet) Source {
+	return flagSource{fs: fs}
+}
+
+func (s flagSource) Name() string {
+	return "flags"
+}
+
+func (s flagSource) stringValues() bool {
+	return true
+}
+
+func (s flagSource) Load(ctx context.Context) (map[string]any, error) {
+	values, _, err := s.loadWithOrigins(ctx)
+	return values, err
+}
+
+func (s flagSource) loadWithOrigins(context.Context) (map[string]any, map[string]string, error) {
+	values := make(map[string]any)
+	origins := make(map[string]string)
+	s.fs.Visit(func(f *flag.Flag) {
+		values[flagKey(f.Name)] = f.Value.String()
+		origins[flagKey(f.Name)] = "flag -" + f.Name
+	})
+
+	return values, origins, nil
+}
+
+func flagKey(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+var fileSourceTests = []struct {
+	name    string
+	file    string
+	content string
+	want    map[string]any
+}{
+	{
+		name:    "yaml",
+		file:    "config.yaml",
+		content: "db_host: localhost\ndb_port: 5432\nkafka:\n  brokers: [b1, b2]\n",
+		want:    map[string]any{"db_host": "localhost", "db_port": 5432, "kafka": map[string]any{"brokers": []any{"b1", "b2"}}},
+	},
+	{
+		name:    "json",
+		file:    "config.json",
+		content: `{"db_host": "localhost", "db_port": 5432}`,
+		want:    map[string]any{"db_host": "localhost", "db_port": json.Number("5432")},
+	},
+	{
+		name: "dotenv",
+		file: ".env",
+		content: `# local dev
+DB_HOST=localhost
+export DB_PORT=5432
+DB_PASSWORD="with # hash"
+LOG_LEVEL=debug # inline comment
+`,
+		want: map[string]any{"db_host": "localhost", "db_port": "5432", "db_password": "with # hash", "log_level": "debug"},
+	},
+	{
+		name:    "empty yaml",
+		file:    "empty.yml",
+		content: "",
+		want:    map[string]any{},
+	},
+}
+
+func TestFileSource(t *testing.T) {
+	for _, test := range fileSourceTests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := FileSource(writeTestFile(t, test.file, test.content)).Load(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.want, values)
+		})
+	}
+}
+
+var fileSourceErrorsTests = []struct {
+	name    string
+	file    string
+	content string
+	err     error
+}{
+	{"unknown extension", "config.toml", "a = 1", ErrUnsupportedFileFormat},
+	{"broken json", "config.json", "{", ErrInvalidConfigFile},
+	{"broken yaml", "config.yaml", "a: [", ErrInvalidConfigFile},
+	{"broken dotenv", "app.env", "NOT A PAIR", ErrInvalidConfigFile},
+}
+
+func TestFileSourceErrors(t *testing.T) {
+	for _, test := range fileSourceErrorsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FileSource(writeTestFile(t, test.file, test.content)).Load(context.Background())
+			assert.True(t, errors.Is(err, test.err), "got error %v", err)
+		})
+	}
+
+	_, err := FileSource(filepath.Join(t.TempDir(), "missing.yaml")).Load(context.Background())
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLayeredSources(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("db-user", "flag-default", "")
+	fs.String("log-level", "info", "")
+	require.NoError(t, fs.Parse([]string{"-db-user", "from-flag"}))
+
+	t.Setenv("VCM_TEST_DB_USER", "from-env")
+	t.Setenv("VCM_TEST_DB_PORT", "6432")
+
+	require.NoError(t, sm.AddSource(ctx, LevelDefaults, DefaultsSource(map[string]any{
+		"db_host": "localhost", "db_port": 5432, "db_user": "default",
+	})))
+	configFile := writeTestFile(t, "config.yaml", "db_host: db.local\ndb_user: from-file\n")
+	require.NoError(t, sm.AddSource(ctx, LevelFiles, FileSource(configFile)))
+	require.NoError(t, sm.AddSource(ctx, LevelOverrides, FlagSource(fs)))
+	require.NoError(t, sm.SetEnvOverrides(EnvOverrides{Prefix: "VCM_TEST_"}))
+	assert.True(t, errors.Is(sm.AddSource(ctx, LevelVault, DefaultsSource(nil)), ErrInvalidSourceLevel))
+
+	// флаг сильнее окружения, окружение сильнее vault'a, vault сильнее файлов, файлы сильнее дефолтов
+	user, err := sm.GetString("db_user")
+	require.NoError(t, err)
+	assert.Equal(t, "from-flag", user)
+
+	port, err := sm.GetInt("db_port")
+	require.NoError(t, err)
+	assert.Equal(t, 6432, port)
+
+	password, err := sm.GetSecretStringFromConfig("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "old", password)
+
+	host, err := sm.GetString("db_host")
+	require.NoError(t, err)
+	assert.Equal(t, "db.local", host)
+
+	// флаг со значением по умолчанию ничего не перекрывает
+	_, err = sm.GetString("log_level")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+
+	explanation := sm.Explain("db_user")
+	assert.True(t, explanation.Found)
+	assert.Equal(t, KeyOrigin{Level: LevelOverrides, Source: "flag -db-user", Value: "from-flag"}, explanation.Winner)
+	assert.Equal(t, []KeyOrigin{
+		{Level: LevelOverrides, Source: "env VCM_TEST_DB_USER", Value: "from-env"},
+		{Level: LevelVault, Source: "vault kv/data/main/db", Value: "app"},
+		{Level: LevelFiles, Source: "file " + configFile, Value: "from-file"},
+		{Level: LevelDefaults, Source: "defaults", Value: "default"},
+	}, explanation.Shadowed)
+
+	assert.Equal(t, "db_port: env VCM_TEST_DB_PORT (overrides defaults)", sm.Explain("db_port").String())
+	assert.Equal(t, "missing: not found", sm.Explain("missing").String())
+
+	assert.Equal(t, []ConfigOverride{
+		{Key: "db_port", Source: "env VCM_TEST_DB_PORT"},
+		{Key: "db_user", Source: "flag -db-user"},
+	}, sm.Status().Overrides)
+
+	var dump bytes.Buffer
+	require.NoError(t, sm.DebugDump(&dump))
+	assert.Contains(t, dump.String(), "db_password  vault kv/data/main/db\n")
+	assert.Contains(t, dump.String(), "db_host      file "+configFile+" (overrides defaults)\n")
+	assert.NotContains(t, dump.String(), "from-flag")
+}
+
+func TestExplainPath(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	require.NoError(t, sm.AddSource(context.Background(), LevelDefaults, DefaultsSource(map[string]any{
+		"kafka": map[string]any{"brokers": []any{"localhost:9092"}},
+	})))
+
+	brokers, err := sm.GetString("kafka.brokers[0]")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9092", brokers)
+
+	explanation := sm.Explain("kafka.brokers[0]")
+	assert.True(t, explanation.Found)
+	assert.Equal(t, "defaults", explanation.Winner.Source)
+}
+
+func TestReloadSources(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	path := writeTestFile(t, "config.json", `{"feature": true}`)
+
+	sm, err := NewSecretManagerWithOptions(WithVaultClient(sm.vaultClient), WithMount("kv", "main"), WithSource(LevelFiles, FileSource(path)))
+	require.NoError(t, err)
+
+	enabled, err := sm.GetBool("feature")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"feature": false}`), 0o600))
+	require.NoError(t, sm.ReloadSources(context.Background()))
+
+	enabled, err = sm.GetBool("feature")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	select {
+	case <-sm.GetNotifierChannel():
+	default:
+		t.Fatal("expected change notification after source reload")
+	}
+
+	// сломанный файл не затирает прошлые значения
+	require.NoError(t, os.WriteFile(path, []byte(`{`), 0o600))
+	assert.True(t, errors.Is(sm.ReloadSources(context.Background()), ErrInvalidConfigFile))
+
+	enabled, err = sm.GetBool("feature")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+}
+
+var sourceConversionTests = []struct {
+	name        string
+	level       SourceLevel
+	source      func(t *testing.T) Source
+	expectedErr error
+}{
+	{
+		name:  "dotenv",
+		level: LevelFiles,
+		source: func(t *testing.T) Source {
+			return FileSource(writeTestFile(t, ".env", "DB_PORT=6432\n"))
+		},
+	},
+	{
+		name:  "env",
+		level: LevelOverrides,
+		source: func(t *testing.T) Source {
+			t.Setenv("VCM_CONVERT_DB_PORT", "6432")
+			return EnvSource(EnvOverrides{Prefix: "VCM_CONVERT_"})
+		},
+	},
+	{
+		name:  "flags",
+		level: LevelOverrides,
+		source: func(t *testing.T) Source {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Int("db-port", 5432, "")
+			require.NoError(t, fs.Parse([]string{"-db-port", "6432"}))
+			return FlagSource(fs)
+		},
+	},
+	{
+		name:  "yaml string",
+		level: LevelFiles,
+		source: func(t *testing.T) Source {
+			return FileSource(writeTestFile(t, "config.yaml", "db_port: \"6432\"\n"))
+		},
+		expectedErr: ErrWhileConvertingToInt,
+	},
+	{
+		name:  "json string",
+		level: LevelFiles,
+		source: func(t *testing.T) Source {
+			return FileSource(writeTestFile(t, "config.json", `{"db_port": "6432"}`))
+		},
+		expectedErr: ErrWhileConvertingToInt,
+	},
+	{
+		name:  "defaults string",
+		level: LevelDefaults,
+		source: func(t *testing.T) Source {
+			return DefaultsSource(map[string]any{"db_port": "6432"})
+		},
+		expectedErr: ErrWhileConvertingToInt,
+	},
+}
+
+func TestSourceConversion(t *testing.T) {
+	for _, test := range sourceConversionTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, sm := newTestManager(t, writeTestSetup)
+			require.NoError(t, sm.AddSource(context.Background(), test.level, test.source(t)))
+
+			// строки мягко разбираются только из источников, которые других типов не умеют
+			port, err := sm.GetInt("db_port")
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			if test.expectedErr == nil {
+				assert.Equal(t, 6432, port)
+			}
+
+			_, err = sm.GetSecretIntFromConfig("db_port")
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+
+			port, err = sm.GetInt("db_port", Lenient())
+			require.NoError(t, err)
+			assert.Equal(t, 6432, port)
+		})
+	}
+}
+
+func TestSourcesReplaceNestedObjects(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	require.NoError(t, sm.AddSource(ctx, LevelDefaults, DefaultsSource(map[string]any{
+		"kafka": map[string]any{"brokers": []any{"localhost:9092"}, "retries": 3},
+	})))
+	require.NoError(t, sm.AddSource(ctx, LevelFiles, FileSource(writeTestFile(t, "config.yaml", "kafka:\n  brokers: [b1:9092]\n"))))
+
+	// kafka из файла заменяет kafka из дефолтов целиком, retries не наследуется
+	broker, err := sm.GetString("kafka.brokers[0]")
+	require.NoError(t, err)
+	assert.Equal(t, "b1:9092", broker)
+
+	_, err = sm.GetInt("kafka.retries")
+	assert.True(t, errors.Is(err, ErrKeyNotFound), "got error %v", err)
+
+	// db_user, db_password и brokers из vault'a плюс kafka из файлов
+	assert.Equal(t, 4, sm.Status().Keys)
+}
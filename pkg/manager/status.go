@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"time"
+)
+
+// Status - снимок состояния менеджера для health-check'ов и дебага
+type Status struct {
+	// Sealed - последнее известное состояние печати. Заполняется вотчером печати, без него всегда false
+	Sealed             bool
+	SealCheckedAt      time.Time
+	SealWatcherRunning bool
+
+	// RefreshPaused - апдейтер пропускает обновления, потому что vault запечатан
+	RefreshPaused bool
+
+	LastRefreshAt    time.Time
+	LastRefreshError error
+
+	// ServedFromCache - конфиг поднят из кэша на диске (WithConfigCache), потому что при старте vault был недоступен.
+	// Сбрасывается первым удачным обновлением из vault'a
+	ServedFromCache bool
+	// CacheSavedAt - когда был записан кэш, из которого поднят конфиг
+	CacheSavedAt time.Time
+	// CacheWriteError - ошибка последней записи кэша, nil - записался или кэш выключен
+	CacheWriteError error
+
+	// Keys - сколько ключей верхнего уровня в итоговом конфиге, со всех источников, а не только из vault'a
+	Keys int
+
+	// Environment - окружение, чей оверлей грузится поверх базы (WithOverlays), пустое без оверлеев
+	Environment string
+
+	// Overrides - ключи, которые берутся с уровня LevelOverrides (окружение, флаги), без значений
+	Overrides []ConfigOverride
+
+	// KeyCollisions - ключи, которые при последнем полном обновлении нашлись в нескольких папках или путях vault'a
+	KeyCollisions []KeyCollision
+
+	// PinnedFolders - папки, закрепленные через PinFolder/WithPinnedVersion, без истекших
+	PinnedFolders []FolderPin
+
+	// ExpiringSecrets - истекающие, истекшие и неправильно размеченные папки по последней проверке сроков,
+	// пусто, если отслеживание не включено через SetExpiryTracking/WithExpiryTracking
+	ExpiringSecrets []SecretExpiry
+	ExpiryCheckedAt time.Time
+
+	// DatabaseLeases - аренды динамических кредов, которые отслеживает менеджер
+	DatabaseLeases []DatabaseLease
+}
+
+// managerState - изменяемое состояние, которое отдается через Status. Живет под своим мьютексом,
+// чтобы не мешать геттерам конфига
+type managerState struct {
+	sealed             bool
+	sealCheckedAt      time.Time
+	sealWatcherRunning bool
+	sealWatcherStarted bool // вотчер запускается один раз, см. StartSealWatcher
+
+	lastRefreshAt    time.Time
+	lastRefreshError error
+	vaultLoaded      bool // хоть раз удачно загрузились из vault'a
+
+	servedFromCache bool
+	cacheSavedAt    time.Time
+	cacheWriteError error
+
+	expiries        []SecretExpiry
+	expiryCheckedAt time.Time
+	expiryGauges    map[string]struct{} // папки, для которых выставлен MetricSecretExpiresIn
+}
+
+// Status возвращает текущее состояние менеджера
+func (sm *SecretManagerVault) Status() Status {
+	sm.RLock()
+	keys := len(sm.keysLocked())
+	overrides := sm.overridesLocked()
+	collisions := keyCollisions(sm.vaultOrigins, sm.overlayShadowed)
+	sm.RUnlock()
+
+	databaseLeases := sm.DatabaseLeases()
+
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	var expiring []SecretExpiry
+	for _, expiry := range sm.state.expiries {
+		if expiry.State != ExpiryOK {
+			expiring = append(expiring, expiry)
+		}
+	}
+
+	return Status{
+		Sealed:             sm.state.sealed,
+		SealCheckedAt:      sm.state.sealCheckedAt,
+		SealWatcherRunning: sm.state.sealWatcherRunning,
+		RefreshPaused:      sm.state.sealWatcherRunning && sm.state.sealed,
+		LastRefreshAt:      sm.state.lastRefreshAt,
+		LastRefreshError:   sm.state.lastRefreshError,
+		ServedFromCache:    sm.state.servedFromCache,
+		CacheSavedAt:       sm.state.cacheSavedAt,
+		CacheWriteError:    sm.state.cacheWriteError,
+		Keys:               keys,
+		Environment:        sm.Environment(),
+		Overrides:          overrides,
+		KeyCollisions:      collisions,
+		PinnedFolders:      sm.pinnedFoldersLocked(),
+		ExpiringSecrets:    expiring,
+		ExpiryCheckedAt:    sm.state.expiryCheckedAt,
+		DatabaseLeases:     databaseLeases,
+	}
+}
+
+// recordRefresh запоминает результат очередного похода в vault за полным конфигом
+func (sm *SecretManagerVault) recordRefresh(err error) {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	sm.state.lastRefreshAt = time.Now()
+	sm.state.lastRefreshError = err
+
+	if err == nil {
+		sm.state.vaultLoaded = true
+		sm.state.servedFromCache = false
+		sm.state.cacheSavedAt = time.Time{}
+	}
+}
+
+// vaultLoaded - конфиг хоть раз удачно загрузился из vault'a. До этого при недоступном vault'e можно подняться из кэша
+func (sm *SecretManagerVault) vaultLoaded() bool {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	return sm.state.vaultLoaded
+}
+
+// refreshPaused - true, пока вотчер печати видит запечатанный vault
+func (sm *SecretManagerVault) refreshPaused() bool {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	return sm.state.sealWatcherRunning && sm.state.sealed
+}
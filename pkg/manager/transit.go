@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultTransitMount - маунт transit secrets engine по умолчанию
+const DefaultTransitMount = "transit"
+
+var (
+	ErrTransitNotConfigured = errors.New("transit key is not configured")
+	ErrTransitDecrypt       = errors.New("error decrypting transit ciphertext")
+)
+
+// transitCiphertext - как выглядит шифротекст transit: vault:v<версия ключа>:<base64>
+var transitCiphertext = regexp.MustCompile(`^vault:v\d+:`)
+
+// IsTransitCiphertext - похоже ли значение на шифротекст transit
+func IsTransitCiphertext(value string) bool {
+	return transitCiphertext.MatchString(value)
+}
+
+// transitState - настройки transit и кэш расшифрованных значений: шифротекст -> открытый текст.
+// Пока значение в vault'e не меняется, апдейтер не ходит за ним в transit на каждом обновлении
+type transitState struct {
+	sync.Mutex
+	mount string
+	key   string
+
+	cache map[string]string
+	used  map[string]struct{} // что понадобилось с прошлой чистки
+}
+
+func newTransitState() *transitState {
+	return &transitState{
+		mount: normalizeMount(DefaultTransitMount),
+		cache: make(map[string]string),
+		used:  make(map[string]struct{}),
+	}
+}
+
+// SetTransitKey включает прозрачную расшифровку: строковые значения вида vault:v1:... при загрузке из KV
+// расшифровываются через <mount>/decrypt/<key>. Пустой mount - DefaultTransitMount, пустой key выключает расшифровку
+func (sm *SecretManagerVault) SetTransitKey(mount, key string) {
+	if mount == "" {
+		mount = DefaultTransitMount
+	}
+
+	sm.transit.Lock()
+	defer sm.transit.Unlock()
+
+	sm.transit.mount = normalizeMount(mount)
+	sm.transit.key = key
+	sm.transit.cache = make(map[string]string)
+	sm.transit.used = make(map[string]struct{})
+}
+
+// Encrypt шифрует plaintext ключом key через transit и возвращает шифротекст vault:v<N>:...
+// Пустой key - ключ из SetTransitKey/WithTransit
+func (sm *SecretManagerVault) Encrypt(ctx context.Context, key string, plaintext []byte) (string, error) {
+	mount, key, err := sm.transitTarget(key)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := sm.vaultClient.Logical().WriteWithContext(ctx, mount+"encrypt/"+key, map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		sm.logger.Error("Error encrypting with transit", "key", key, "error", err)
+		return "", err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return "", ErrEmptyVaultResponse
+	}
+
+	ciphertext, _ := resp.Data["ciphertext"].(string)
+	if ciphertext == "" {
+		return "", ErrEmptyVaultResponse
+	}
+
+	return ciphertext, nil
+}
+
+// Decrypt расшифровывает шифротекст transit ключом key. Пустой key - ключ из SetTransitKey/WithTransit.
+// Кэш здесь не используется, он только для значений конфига
+func (sm *SecretManagerVault) Decrypt(ctx context.Context, key string, ciphertext string) ([]byte, error) {
+	mount, key, err := sm.transitTarget(key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sm.vaultClient.Logical().WriteWithContext(ctx, mount+"decrypt/"+key, map[string]any{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTransitDecrypt, err)
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	encoded, _ := resp.Data["plaintext"].(string)
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTransitDecrypt, err)
+	}
+
+	return plaintext, nil
+}
+
+func (sm *SecretManagerVault) transitTarget(key string) (string, string, error) {
+	sm.transit.Lock()
+	defer sm.transit.Unlock()
+
+	if key == "" {
+		key = sm.transit.key
+	}
+
+	if key == "" {
+		return "", "", ErrTransitNotConfigured
+	}
+
+	return sm.transit.mount, strings.Trim(key, "/"), nil
+}
+
+// decodeSecretValue - все, что происходит со значением при загрузке из vault'a: расшифровка transit, если она включена
+// и значение похоже на шифротекст, а потом разбор JSON для ключей из SetJSONKeys
+func (sm *SecretManagerVault) decodeSecretValue(ctx context.Context, key string, value any) (any, error) {
+	if ciphertext, ok := value.(string); ok && IsTransitCiphertext(ciphertext) {
+		plaintext, decrypted, err := sm.decryptConfigValue(ctx, ciphertext)
+		if err != nil {
+			return value, fmt.Errorf("key %q: %w", key, err)
+		}
+		if decrypted {
+			value = plaintext
+		}
+	}
+
+	return sm.decodeJSONValue(key, value)
+}
+
+// decryptConfigValue расшифровывает значение конфига через кэш. false - transit не настроен, значение остается как есть
+func (sm *SecretManagerVault) decryptConfigValue(ctx context.Context, ciphertext string) (string, bool, error) {
+	sm.transit.Lock()
+	if sm.transit.key == "" {
+		sm.transit.Unlock()
+		return "", false, nil
+	}
+	plaintext, cached := sm.transit.cache[ciphertext]
+	sm.transit.used[ciphertext] = struct{}{}
+	sm.transit.Unlock()
+
+	if cached {
+		return plaintext, true, nil
+	}
+
+	decrypted, err := sm.Decrypt(ctx, "", ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+
+	sm.transit.Lock()
+	sm.transit.cache[ciphertext] = string(decrypted)
+	sm.transit.Unlock()
+
+	return string(decrypted), true, nil
+}
+
+// sweepTransitCache выкидывает из кэша то, что не понадобилось со времени прошлой чистки.
+// Зовется после полного обновления конфига, так что в кэше остаются только живые значения
+func (sm *SecretManagerVault) sweepTransitCache() {
+	sm.transit.Lock()
+	defer sm.transit.Unlock()
+
+	for ciphertext := range sm.transit.cache {
+		if _, used := sm.transit.used[ciphertext]; !used {
+			delete(sm.transit.cache, ciphertext)
+		}
+	}
+	sm.transit.used = make(map[string]struct{})
+}
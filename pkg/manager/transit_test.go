@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransit "шифрует" в base64 с префиксом версии и считает расшифровки
+type fakeTransit struct {
+	decrypts atomic.Int32
+}
+
+func (fv *fakeVault) enableTransit(mount, key string) *fakeTransit {
+	transit := &fakeTransit{}
+
+	fv.handle(mount+"/encrypt/"+key, func(r *fakeRequest) any {
+		plaintext, _ := r.body["plaintext"].(string)
+		return map[string]any{"data": map[string]any{"ciphertext": "vault:v1:" + plaintext}}
+	})
+
+	fv.handle(mount+"/decrypt/"+key, func(r *fakeRequest) any {
+		transit.decrypts.Add(1)
+
+		ciphertext, _ := r.body["ciphertext"].(string)
+		if !strings.HasPrefix(ciphertext, "vault:v1:") {
+			return &fakeVaultError{code: http.StatusBadRequest, messages: []string{"invalid ciphertext"}}
+		}
+		return map[string]any{"data": map[string]any{"plaintext": strings.TrimPrefix(ciphertext, "vault:v1:")}}
+	})
+
+	return transit
+}
+
+func fakeCiphertext(plaintext string) string {
+	return "vault:v1:" + base64.StdEncoding.EncodeToString([]byte(plaintext))
+}
+
+func TestTransitEncryptDecrypt(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.enableTransit("transit", "app")
+
+	sm, err := NewSecretManagerWithOptions(WithAddress(fv.server.URL), WithToken(testVaultToken))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = sm.Encrypt(ctx, "", []byte("secret"))
+	assert.True(t, errors.Is(err, ErrTransitNotConfigured))
+
+	ciphertext, err := sm.Encrypt(ctx, "app", []byte("secret"))
+	require.NoError(t, err)
+	assert.True(t, IsTransitCiphertext(ciphertext))
+
+	plaintext, err := sm.Decrypt(ctx, "app", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = sm.Decrypt(ctx, "app", "garbage")
+	assert.True(t, errors.Is(err, ErrTransitDecrypt))
+}
+
+func TestTransparentTransitDecryption(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	transit := fv.enableTransit("encryption", "config")
+	fv.putSecret("kv/main/db", map[string]any{
+		"db_password": fakeCiphertext("hunter2"),
+		"db_options":  fakeCiphertext(`{"pool": 10}`),
+		"db_user":     "app",
+	})
+
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithMount("kv", "main"),
+		WithTransit("encryption", "config"),
+		WithJSONKeys("db_options"),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "hunter2", sm.config["db_password"])
+	assert.Equal(t, "app", sm.config["db_user"])
+
+	pool, err := sm.GetInt("db_options.pool")
+	require.NoError(t, err)
+	assert.Equal(t, 10, pool)
+	assert.Equal(t, int32(2), transit.decrypts.Load())
+
+	// повторное чтение берет расшифрованное из кэша
+	value, err := sm.UpdateSpecificSecret("db", "db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, int32(2), transit.decrypts.Load())
+
+	// новое значение - новый поход в transit, старое вычищается из кэша
+	fv.putSecret("kv/main/db", map[string]any{"db_password": fakeCiphertext("rotated"), "db_user": "app"})
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, "rotated", sm.config["db_password"])
+	assert.Equal(t, int32(3), transit.decrypts.Load())
+	assert.Len(t, sm.transit.cache, 1)
+
+	// шифротекст, который не расшифровывается, не попадает в конфиг
+	fv.putSecret("kv/main/db", map[string]any{"db_password": "vault:v2:broken", "db_user": "app"})
+	assert.Error(t, sm.UpdateConfig())
+	assert.Equal(t, "rotated", sm.config["db_password"])
+}
+
+func TestTransitDisabledKeepsCiphertext(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	fv.putSecret("kv/main/db", map[string]any{"db_password": fakeCiphertext("hunter2")})
+
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, fakeCiphertext("hunter2"), sm.config["db_password"])
+}
@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	ErrAlreadyUnsealed       = errors.New("vault is already unsealed")
+	ErrBadUnsealKey          = errors.New("unseal key rejected by vault")
+	ErrUnsealThresholdNotMet = errors.New("unseal keys exhausted before the threshold was met")
+)
+
+// UnsealProgress - состояние распечатывания после очередного шага, как его вернул vault
+type UnsealProgress struct {
+	Sealed    bool
+	Threshold int
+	Shares    int
+	Progress  int
+	Nonce     string
+}
+
+func unsealProgressFromStatus(status *vaultapi.SealStatusResponse) UnsealProgress {
+	return UnsealProgress{
+		Sealed:    status.Sealed,
+		Threshold: status.T,
+		Shares:    status.N,
+		Progress:  status.Progress,
+		Nonce:     status.Nonce,
+	}
+}
+
+// UnsealKeySource отдает ключи для распечатывания. Вызывается на каждую попытку заново,
+// поэтому один и тот же источник можно отдать и в Unseal, и в вотчер
+type UnsealKeySource interface {
+	UnsealKeys(ctx context.Context) ([]string, error)
+}
+
+// UnsealKeysFunc - ключи из функции: переменные окружения, секрет-стор, запрос у оператора и т.д.
+type UnsealKeysFunc func(ctx context.Context) ([]string, error)
+
+func (f UnsealKeysFunc) UnsealKeys(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// StaticUnsealKeys - ключи, которые уже лежат в памяти
+type StaticUnsealKeys []string
+
+func (k StaticUnsealKeys) UnsealKeys(context.Context) ([]string, error) {
+	return k, nil
+}
+
+type readerUnsealKeys struct {
+	reader io.Reader
+
+	once sync.Once
+	keys []string
+	err  error
+}
+
+// UnsealKeysFromReader читает ключи по одному на строку, пустые строки и строки с # пропускаются.
+// Reader вычитывается один раз при первом обращении, дальше ключи отдаются из памяти
+func UnsealKeysFromReader(reader io.Reader) UnsealKeySource {
+	return &readerUnsealKeys{reader: reader}
+}
+
+func (r *readerUnsealKeys) UnsealKeys(context.Context) ([]string, error) {
+	r.once.Do(func() {
+		scanner := bufio.NewScanner(r.reader)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			r.keys = append(r.keys, line)
+		}
+		r.err = scanner.Err()
+	})
+
+	return r.keys, r.err
+}
+
+// UnsealOptions - настройки Unseal
+type UnsealOptions struct {
+	// Reset сбрасывает уже начатое кем-то распечатывание, прежде чем кормить свои ключи
+	Reset bool
+
+	// OnProgress вызывается после каждого принятого vault'ом ключа
+	OnProgress func(UnsealProgress)
+}
+
+// SealStatus возвращает текущее состояние распечатывания
+func (sm *SecretManagerVault) SealStatus(ctx context.Context) (UnsealProgress, error) {
+	status, err := sm.vaultClient.Sys().SealStatusWithContext(ctx)
+	if err != nil {
+		return UnsealProgress{}, err
+	}
+
+	return unsealProgressFromStatus(status), nil
+}
+
+// ResetUnseal сбрасывает частично введенные ключи, прогресс снова начинается с нуля
+func (sm *SecretManagerVault) ResetUnseal(ctx context.Context) (UnsealProgress, error) {
+	status, err := sm.vaultClient.Sys().ResetUnsealProcessWithContext(ctx)
+	if err != nil {
+		sm.logger.Error("Error resetting unseal process", "error", err)
+		return UnsealProgress{}, err
+	}
+
+	return unsealProgressFromStatus(status), nil
+}
+
+// Unseal распечатывает vault ключами из source и ничего не фаталит. Ключи подаются по одному, пока vault не
+// распечатается, прогресс после каждого ключа уходит в OnProgress. Ошибки:
+// ErrAlreadyUnsealed - распечатывать было нечего, ErrBadUnsealKey - vault отверг ключ,
+// ErrUnsealThresholdNotMet - ключи кончились раньше порога. Вместе с ошибкой возвращается последний известный прогресс
+func (sm *SecretManagerVault) Unseal(ctx context.Context, source UnsealKeySource, opts UnsealOptions) (UnsealProgress, error) {
+	progress, err := sm.SealStatus(ctx)
+	if err != nil {
+		sm.logger.Error("Error getting seal status", "error", err)
+		return progress, err
+	}
+
+	if !progress.Sealed {
+		return progress, ErrAlreadyUnsealed
+	}
+
+	if opts.Reset {
+		if progress, err = sm.ResetUnseal(ctx); err != nil {
+			return progress, err
+		}
+	}
+
+	keys, err := source.UnsealKeys(ctx)
+	if err != nil {
+		sm.logger.Error("Error getting unseal keys", "error", err)
+		return progress, err
+	}
+
+	for i, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		if err = ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		status, err := sm.vaultClient.Sys().UnsealWithContext(ctx, key)
+		if err != nil {
+			var respErr *vaultapi.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest {
+				err = fmt.Errorf("%w: key #%d: %w", ErrBadUnsealKey, i+1, err)
+			}
+			sm.logger.Error("Error unsealing Vault with key", "attempt", i+1, "error", err)
+			return progress, err
+		}
+
+		progress = unsealProgressFromStatus(status)
+		sm.logger.Info("Unseal key accepted",
+			"attempt", i+1, "progress", progress.Progress, "threshold", progress.Threshold, "sealed", progress.Sealed)
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+
+		if !progress.Sealed {
+			sm.logger.Info("Vault unsealed successfully")
+			return progress, nil
+		}
+	}
+
+	return progress, fmt.Errorf("%w: progress %d/%d", ErrUnsealThresholdNotMet, progress.Progress, progress.Threshold)
+}
@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUnsealKeys = []string{"key-1", "key-2", "key-3", "key-4", "key-5"}
+
+var unsealTests = []struct {
+	name             string
+	source           UnsealKeySource
+	preUnsealed      bool
+	expectedProgress []int
+	expectedSealed   bool
+	expectedErr      error
+}{
+	{
+		name:             "static keys",
+		source:           StaticUnsealKeys{"key-1", "key-2", "key-3", "key-4"},
+		expectedProgress: []int{1, 2, 0},
+		expectedSealed:   false,
+	},
+	{
+		name:             "keys from reader",
+		source:           UnsealKeysFromReader(strings.NewReader("# unseal keys\nkey-1\n\n key-2 \nkey-3\n")),
+		expectedProgress: []int{1, 2, 0},
+		expectedSealed:   false,
+	},
+	{
+		name: "keys from func",
+		source: UnsealKeysFunc(func(ctx context.Context) ([]string, error) {
+			return []string{"key-5", "key-4", "key-3"}, nil
+		}),
+		expectedProgress: []int{1, 2, 0},
+		expectedSealed:   false,
+	},
+	{
+		name:             "threshold not met",
+		source:           StaticUnsealKeys{"key-1", "key-2"},
+		expectedProgress: []int{1, 2},
+		expectedSealed:   true,
+		expectedErr:      ErrUnsealThresholdNotMet,
+	},
+	{
+		name:             "bad key",
+		source:           StaticUnsealKeys{"key-1", "nope"},
+		expectedProgress: []int{1},
+		expectedSealed:   true,
+		expectedErr:      ErrBadUnsealKey,
+	},
+	{
+		name:           "already unsealed",
+		source:         StaticUnsealKeys{"key-1"},
+		preUnsealed:    true,
+		expectedSealed: false,
+		expectedErr:    ErrAlreadyUnsealed,
+	},
+}
+
+func TestUnseal(t *testing.T) {
+	for _, test := range unsealTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv := newFakeVault(t)
+			seal := fv.enableSeal(testUnsealKeys, 3)
+			if test.preUnsealed {
+				seal.sealed = false
+			}
+
+			sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+			require.NoError(t, err)
+
+			var seen []int
+			progress, err := sm.Unseal(context.Background(), test.source, UnsealOptions{
+				OnProgress: func(p UnsealProgress) {
+					seen = append(seen, p.Progress)
+				},
+			})
+
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.Equal(t, test.expectedProgress, seen)
+			assert.Equal(t, test.expectedSealed, progress.Sealed)
+			assert.Equal(t, test.expectedSealed, seal.isSealed())
+		})
+	}
+}
+
+func TestUnsealWithReset(t *testing.T) {
+	fv := newFakeVault(t)
+	seal := fv.enableSeal(testUnsealKeys, 3)
+
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	progress, err := sm.Unseal(context.Background(), StaticUnsealKeys{"key-1", "key-2"}, UnsealOptions{})
+	assert.True(t, errors.Is(err, ErrUnsealThresholdNotMet))
+	assert.Equal(t, 2, progress.Progress)
+
+	progress, err = sm.Unseal(context.Background(), StaticUnsealKeys{"key-3"}, UnsealOptions{Reset: true})
+	assert.True(t, errors.Is(err, ErrUnsealThresholdNotMet))
+	assert.Equal(t, 1, progress.Progress)
+	assert.True(t, seal.isSealed())
+}
+
+func TestUnsealVault(t *testing.T) {
+	fv := newFakeVault(t)
+	seal := fv.enableSeal(testUnsealKeys, 3)
+
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+	require.NoError(t, err)
+
+	// ключей не хватает - ошибка, а не os.Exit
+	assert.True(t, errors.Is(sm.UnsealVault([]string{"key-1"}), ErrUnsealThresholdNotMet))
+
+	require.NoError(t, sm.UnsealVault(testUnsealKeys))
+	assert.False(t, seal.isSealed())
+	assert.NoError(t, sm.UnsealVault(testUnsealKeys))
+}
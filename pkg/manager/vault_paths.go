@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MetricConfigKeyCollisions - сколько ключей нашлось сразу в нескольких папках или путях vault'a
+const MetricConfigKeyCollisions = "vault_config_key_collisions"
+
+const vaultSourcePrefix = "vault "
+
+// VaultPath - дополнительный путь KV, с которого грузится конфиг, например ("kv", "common").
+// Версия KV определяется сама, как в WithMount
+type VaultPath struct {
+	Mount  string
+	Prefix string
+}
+
+// KeyCollision - ключ, который есть в нескольких папках vault'a. Winner и Shadowed - полные пути до папок
+// вида "kv/data/payments/db", Shadowed - от сильного к слабому
+type KeyCollision struct {
+	Key      string
+	Winner   string
+	Shadowed []string
+}
+
+// readFolderConfig читает папку дополнительного пути. Версии, закрепления и сроки там не отслеживаются,
+// это все только для основного пути, в который менеджер и пишет
+func (sm *SecretManagerVault) readFolderConfig(kv kvMount, folder string) (config, error) {
+	cfg := config(make(map[string]any))
+
+	secretData, _, err := sm.readSecretFrom(context.Background(), kv, folder, 0)
+	if err != nil {
+		if !errors.Is(err, ErrEmptyVaultResponse) {
+			sm.logger.Error("Error reading secrets", "folder", kv.dataPath()+folder, "error", err)
+		}
+		return cfg, err
+	}
+
+	err = sm.decodeFolderData(kv.dataPath()+folder, secretData, cfg)
+	return cfg, err
+}
+
+// KeyCollisions - ключи, которые при последнем полном обновлении нашлись в нескольких папках, отсортированные по ключу
+func (sm *SecretManagerVault) KeyCollisions() []KeyCollision {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	return keyCollisions(sm.vaultOrigins, sm.overlayShadowed)
+}
+
+// keyCollisions собирает коллизии из origins. Папки базы, которые перекрыл оверлей, пропускаются: оверлей для того
+// и нужен, чтобы переопределять базу
+func keyCollisions(origins map[string][]KeyOrigin, overlayShadowed map[string]map[string]bool) []KeyCollision {
+	var collisions []KeyCollision
+	for key, keyOrigins := range origins {
+		if shadowed := overlayShadowed[key]; len(shadowed) > 0 {
+			keyOrigins = slices.DeleteFunc(slices.Clone(keyOrigins), func(origin KeyOrigin) bool {
+				return shadowed[origin.Source]
+			})
+		}
+		if len(keyOrigins) < 2 {
+			continue
+		}
+
+		collision := KeyCollision{Key: key, Winner: vaultFolderFromSource(keyOrigins[0].Source), Shadowed: make([]string, 0, len(keyOrigins)-1)}
+		for _, origin := range keyOrigins[1:] {
+			collision.Shadowed = append(collision.Shadowed, vaultFolderFromSource(origin.Source))
+		}
+		collisions = append(collisions, collision)
+	}
+
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Key < collisions[j].Key
+	})
+
+	return collisions
+}
+
+// vaultSource - как папка vault'a выглядит в KeyOrigin.Source
+func vaultSource(folderPath string) string {
+	return vaultSourcePrefix + folderPath
+}
+
+func vaultFolderFromSource(source string) string {
+	return strings.TrimPrefix(source, vaultSourcePrefix)
+}
+
+// recordVaultOrigins запоминает, из каких папок пришел каждый ключ. О коллизиях пишем в лог, только когда они поменялись,
+// чтобы апдейтер не повторял одно и то же на каждом обновлении
+func (sm *SecretManagerVault) recordVaultOrigins(origins map[string][]KeyOrigin, overlayShadowed map[string]map[string]bool) {
+	collisions := keyCollisions(origins, overlayShadowed)
+
+	sm.Lock()
+	changed := !reflect.DeepEqual(keyCollisions(sm.vaultOrigins, sm.overlayShadowed), collisions)
+	sm.vaultOrigins, sm.overlayShadowed = origins, overlayShadowed
+	sm.Unlock()
+
+	sm.metrics.SetGauge(MetricConfigKeyCollisions, nil, float64(len(collisions)))
+
+	if !changed {
+		return
+	}
+
+	for _, collision := range collisions {
+		sm.logger.Warn("Config key found in several vault folders",
+			"key", collision.Key, "winner", collision.Winner, "shadowed", collision.Shadowed)
+	}
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var multiPathTestSetup = testManagerSetup{
+	mounts: map[string]int{"kv": KVVersion2, "shared": KVVersion1},
+	secrets: map[string]map[string]any{
+		"shared/common/db": {"db_host": "db.shared", "db_port": 5432, "log_level": "info"},
+		"kv/team/db":       {"db_host": "db.team", "team": "payments"},
+		"kv/payments/db":   {"db_host": "db.payments", "db_password": "secret"},
+	},
+	options: []Option{
+		WithMount("kv", "payments"),
+		WithVaultPaths(VaultPath{Mount: "shared", Prefix: "common"}, VaultPath{Mount: "kv", Prefix: "team"}),
+	},
+}
+
+func TestMultipleVaultPaths(t *testing.T) {
+	metrics := &recordingMetrics{gauges: make(map[string]float64)}
+	_, sm := newTestManager(t, multiPathTestSetup, WithMetrics(metrics))
+
+	// основной путь сильнее дополнительных, из дополнительных сильнее переданный позже
+	assert.Equal(t, config{
+		"db_host":     "db.payments",
+		"db_password": "secret",
+		"db_port":     json.Number("5432"),
+		"log_level":   "info",
+		"team":        "payments",
+	}, sm.config)
+
+	collisions := []KeyCollision{{
+		Key:      "db_host",
+		Winner:   "kv/data/payments/db",
+		Shadowed: []string{"kv/data/team/db", "shared/common/db"},
+	}}
+	assert.Equal(t, collisions, sm.KeyCollisions())
+	assert.Equal(t, collisions, sm.Status().KeyCollisions)
+	assert.Equal(t, float64(1), metrics.gauges[MetricConfigKeyCollisions])
+
+	explanation := sm.Explain("db_host")
+	assert.Equal(t, KeyOrigin{Level: LevelVault, Source: "vault kv/data/payments/db", Value: "db.payments"}, explanation.Winner)
+	assert.Equal(t, []KeyOrigin{
+		{Level: LevelVault, Source: "vault kv/data/team/db", Value: "db.team"},
+		{Level: LevelVault, Source: "vault shared/common/db", Value: "db.shared"},
+	}, explanation.Shadowed)
+
+	assert.Equal(t, "log_level: vault shared/common/db", sm.Explain("log_level").String())
+}
+
+func TestMultipleVaultPathsRefresh(t *testing.T) {
+	fv, sm := newTestManager(t, multiPathTestSetup)
+
+	go sm.StartConfigUpdater(10 * time.Millisecond)
+	t.Cleanup(func() { _ = sm.StopUpdater() })
+
+	// обновление в дополнительном пути подхватывается апдейтером, коллизия уходит
+	fv.putSecret("kv/team/db", map[string]any{"team": "billing"})
+
+	select {
+	case <-sm.GetNotifierChannel():
+	case <-time.After(time.Second):
+		t.Fatal("expected change notification after shared secret changed")
+	}
+
+	team, err := sm.GetString("team")
+	require.NoError(t, err)
+	assert.Equal(t, "billing", team)
+
+	assert.Equal(t, []KeyCollision{{
+		Key:      "db_host",
+		Winner:   "kv/data/payments/db",
+		Shadowed: []string{"shared/common/db"},
+	}}, sm.Status().KeyCollisions)
+}
+
+func TestCollisionsWithinPath(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+	fv.putSecret("kv/main/a", map[string]any{"key": "a"})
+	fv.putSecret("kv/main/b", map[string]any{"key": "b"})
+
+	sm, err := NewSecretManagerForMount(fv.server.URL, testVaultToken, "kv", "main", nilLogger)
+	require.NoError(t, err)
+	require.NoError(t, sm.ReloadConfig())
+
+	collisions := sm.KeyCollisions()
+	require.Len(t, collisions, 1)
+	assert.Equal(t, "key", collisions[0].Key)
+	assert.Equal(t, "vault "+collisions[0].Winner, sm.Explain("key").Winner.Source)
+	assert.Contains(t, []string{"kv/data/main/a", "kv/data/main/b"}, collisions[0].Winner)
+	assert.Equal(t, sm.config["key"], sm.Explain("key").Winner.Value)
+}
+
+func TestVaultPathMissingMount(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+
+	_, err := fv.newManager(WithMount("kv", "payments"), WithVaultPaths(VaultPath{Mount: "missing", Prefix: "common"}))
+	assert.Error(t, err)
+}
@@ -1,7 +1,7 @@
 package manager
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"reflect"
 	"strings"
@@ -20,6 +20,8 @@ var (
 	ErrWhileConvertingToString = errors.New("error converting folderKeyValues to string")
 	ErrWhileConvertingToBool   = errors.New("error converting folderKeyValues to bool")
 	ErrWhileConvertingToInt    = errors.New("error converting folderKeyValues to int")
+	ErrWhileConvertingToInt64  = errors.New("error converting folderKeyValues to int64")
+	ErrWhileConvertingToUint64 = errors.New("error converting folderKeyValues to uint64")
 	ErrWhileConvertingToFloat  = errors.New("error converting folderKeyValues to float64")
 	ErrEmptyVaultResponse      = errors.New("empty vault response")
 	ErrAlreadyClosed           = errors.New("already closed")
@@ -28,16 +30,60 @@ var (
 type SecretManagerVault struct {
 	vaultClient *vaultapi.Client
 	config      config
-	logger      logger
+	logger      Logger
 	notifier    chan struct{}
 	stopChan    chan struct{}
 
+	// notifierMu защищает отправку в notifier от закрытия апдейтером, слать туда можно только через notifyChange
+	notifierMu     sync.Mutex
+	notifierClosed bool
+
 	basePath     string
 	baseMetaPath string
+	kv           kvMount
+	vaultPaths   []kvMount      // дополнительные пути из WithVaultPaths, слабее основного, по возрастанию силы
+	overlay      *overlayLayout // раскладка из WithOverlays, nil - оверлеев нет
+	cache        *configCache   // кэш на диске из WithConfigCache, nil - выключен
+
+	vaultOrigins    map[string][]KeyOrigin     // ключ -> папки vault'a, где он нашелся, от сильной к слабой
+	overlayShadowed map[string]map[string]bool // ключ -> папки базы, перекрытые оверлеем, в коллизии не попадают
+
+	// refreshMu - полные перечитывания идут по одному: апдейтер и перечитывание после записи. Иначе апдейтер, начавший
+	// читать до записи, мог бы вернуть в конфиг старое значение
+	refreshMu sync.Mutex
+
+	// updaterBaseline - конфиг, о котором апдейтер уже уведомил, с ним он сравнивает свежий. Записи с UpdateLocalConfig
+	// правят его вместе с config, чтобы одна запись не давала второе уведомление. nil - апдейтер не запущен
+	updaterBaseline config
+
+	lenientConversion bool
+	jsonKeys          map[string]struct{}
+
+	layers   []*configLayer // источники помимо vault'a по возрастанию уровня, геттеры читают их вместе с config
+	envLayer *configLayer   // слой из SetEnvOverrides, nil - перекрытий из окружения нет
+
+	sealEvents chan SealEvent
+	stateMu    sync.Mutex
+	state      managerState
+
+	folderVersions map[string]int       // под stateMu
+	pins           map[string]folderPin // под stateMu
+
+	expiryWarnWithin time.Duration // под stateMu, 0 - сроки не отслеживаются
+	metrics          Metrics
+
+	dbLeases *databaseLeases
+	transit  *transitState
 
 	*sync.RWMutex
 }
 
+// NewSecretManager создает менеджер по двум готовым путям. Если пути совпадают, считаем маунт KV v1,
+// где чтение и листинг идут по одному пути, иначе - KV v2 с раздельными data/metadata.
+// Пары, которые смотрят в разные места, отклоняются с ErrPathMismatch. В vault при этом не ходим,
+// проверку доступности маунта делает NewSecretManagerForMount.
+// Обертка над NewSecretManagerWithOptions, TLS, namespace и прочее настраиваются там, там же можно передать
+// любой Logger вместо zap
 func NewSecretManager(
 	vaultAddr,
 	token,
@@ -45,92 +91,125 @@ func NewSecretManager(
 	baseMetaPath string,
 	logger *zap.SugaredLogger,
 ) (*SecretManagerVault, error) {
-	vaultConfig := vaultapi.DefaultConfig()
-	if vaultAddr != "" {
-		vaultConfig.Address = vaultAddr
-	}
-
-	client, err := vaultapi.NewClient(vaultConfig)
-	if err != nil {
-		return nil, err
-	}
-
-	if !strings.HasSuffix(basePath, "/") {
-		basePath += "/"
-	}
-
-	if !strings.HasSuffix(baseMetaPath, "/") {
-		baseMetaPath += "/"
-	}
+	return NewSecretManagerWithOptions(
+		WithAddress(vaultAddr),
+		WithToken(token),
+		WithBasePaths(basePath, baseMetaPath),
+		WithLogger(NewZapLogger(logger)),
+	)
+}
 
-	client.SetToken(token)
+// NewSecretManagerForMount создает менеджер по имени маунта и префиксу внутри него, например ("kv", "main").
+// Пути до данных и метаданных выводятся сами, версия KV определяется через sys/internal/ui/mounts.
+// Vault должен быть доступен: здесь же проверяется, что маунт существует и токен может его читать
+func NewSecretManagerForMount(
+	vaultAddr,
+	token,
+	mount,
+	prefix string,
+	logger Logger,
+) (*SecretManagerVault, error) {
+	return NewSecretManagerWithOptions(
+		WithAddress(vaultAddr),
+		WithToken(token),
+		WithMount(mount, prefix),
+		WithLogger(logger),
+	)
+}
 
+func newSecretManagerWithClient(client *vaultapi.Client, kv kvMount, logger Logger) *SecretManagerVault {
 	smConfig := config(make(map[string]any))
 
 	return &SecretManagerVault{
 		vaultClient:  client,
 		config:       smConfig,
 		logger:       logger,
+		metrics:      NewNopMetrics(),
 		notifier:     make(chan struct{}, 1),
+		sealEvents:   make(chan SealEvent, sealEventsBufferSize),
 		stopChan:     make(chan struct{}),
 		RWMutex:      &sync.RWMutex{},
-		basePath:     basePath,
-		baseMetaPath: baseMetaPath,
-	}, nil
+		basePath:     kv.dataPath(),
+		baseMetaPath: kv.metaPath(),
+		kv:           kv,
+
+		folderVersions: make(map[string]int),
+		pins:           make(map[string]folderPin),
+
+		dbLeases: &databaseLeases{
+			mount:  normalizeMount(DefaultDatabaseMount),
+			leases: make(map[string]*databaseLease),
+		},
+		transit: newTransitState(),
+	}
 }
 
-// UnsealVault пытается распечатать хранилище и ФАТАЛИТ, если у него не получается
-func (sm *SecretManagerVault) UnsealVault(unsealKeys []string) {
-	status, err := sm.vaultClient.Sys().SealStatus()
-	if err != nil {
-		sm.logger.Fatalf("Error getting seal status: %v", err)
+// UnsealVault распечатывает хранилище ключами из unsealKeys. Уже распечатанное хранилище - не ошибка.
+//
+// Deprecated: используйте Unseal, он кроме ошибки отдает еще и прогресс
+func (sm *SecretManagerVault) UnsealVault(unsealKeys []string) error {
+	_, err := sm.Unseal(context.Background(), StaticUnsealKeys(unsealKeys), UnsealOptions{})
+	if err != nil && !errors.Is(err, ErrAlreadyUnsealed) {
+		sm.logger.Error("Failed to unseal Vault", "error", err)
+		return err
 	}
 
-	if status.Sealed {
-		for _, key := range unsealKeys {
-			resp, err := sm.vaultClient.Sys().Unseal(strings.TrimSpace(key))
-			if err != nil {
-				sm.logger.Fatalf("Error unsealing Vault with key: %v", err)
-			}
-			if !resp.Sealed {
-				sm.logger.Infof("Vault unsealed successfully")
-				break
-			}
-		}
-
-		status, err = sm.vaultClient.Sys().SealStatus()
-		if err != nil || status.Sealed {
-			sm.logger.Fatalf("Failed to unseal Vault")
-		}
-	}
+	return nil
 }
 
 // UpdateSpecificSecret обновляет секрет СРАЗУ В ТЕКУЩЕМ КОНФИГЕ и возвращает секрет. Начинаем без слэша, в конце - опционально,
-// поскольку мы обращаемся относительно базового пути, который находится в константах BaseDataPath и BaseMetaDataPath
+// поскольку мы обращаемся относительно базового пути (basePath для чтения, baseMetaPath для листинга)
 // пример - UpdateSpecificSecretString("test/", "test")
 func (sm *SecretManagerVault) UpdateSpecificSecret(folder, key string) (any, error) {
-	vaultResponse, err := sm.vaultClient.Logical().Read(sm.basePath + folder)
-	if err != nil {
-		sm.logger.Errorf("Error reading secret at folder '%s': %s", folder, err.Error())
-		return "", err
-	}
+	secretVal, _, err := sm.UpdateSpecificSecretWithVersion(folder, key)
+	return secretVal, err
+}
 
-	if vaultResponse == nil || vaultResponse.Data == nil {
-		sm.logger.Infof("Got nil while reading secret at folder '%s': keyToLookup %s", folder, key)
-		return "", ErrEmptyVaultResponse
+// UpdateSpecificSecretWithVersion - то же, что UpdateSpecificSecret, плюс версия папки, из которой прочитано значение
+// (0 для KV v1). Ее передают в WithCAS, чтобы записать изменения, только если папку за это время никто не трогал.
+// Если папка закреплена через PinFolder, читается закрепленная версия
+func (sm *SecretManagerVault) UpdateSpecificSecretWithVersion(folder, key string) (any, int, error) {
+	pinned := sm.pinnedVersion(folder)
+	secretData, version, err := sm.readSecret(context.Background(), folder, pinned)
+	switch {
+	case errors.Is(err, ErrEmptyVaultResponse):
+		sm.logger.Info("Got nil while reading secret", "folder", folder, "key", key)
+		return "", 0, err
+	case errors.Is(err, ErrNotMapInterface):
+		sm.logger.Error("Error reading secret: failed to convert to map[string]interface{}", "folder", folder, "key", key)
+		return "", 0, err
+	case err != nil:
+		sm.logger.Error("Error reading secret", "folder", folder, "key", key, "error", err)
+		return "", 0, err
 	}
 
-	secretData, okConversionToMapInterface := vaultResponse.Data["data"].(map[string]interface{})
-	if !okConversionToMapInterface {
-		sm.logger.Errorf("Error reading secret at folder '%s': failed to convert to map[string]interface{}", folder)
-		return "", ErrNotMapInterface
+	if pinned == 0 {
+		sm.recordFolderVersion(folder, version)
 	}
 
-	secretVal := secretData[key]
+	secretVal, err := sm.decodeSecretValue(context.Background(), key, secretData[key])
+	if err != nil {
+		sm.logger.Error("Error decoding secret", "folder", folder, "key", key, "error", err)
+		return "", 0, err
+	}
 
 	sm.putSingleSecretStringIntoTheConfig(key, secretVal)
 
-	return secretVal, nil
+	return secretVal, version, nil
+}
+
+// ReadSecret читает папку целиком, не трогая текущий конфиг, и отдает ее версию (0 для KV v1). Значения - как их
+// вернул vault, без разбора JSON-ключей, чтобы их можно было поправить и записать обратно через PutSecret с WithCAS
+func (sm *SecretManagerVault) ReadSecret(ctx context.Context, folder string) (map[string]any, int, error) {
+	secretData, version, err := sm.readSecret(ctx, folder, 0)
+	if err != nil {
+		sm.logger.Error("Error reading secret", "folder", folder, "error", err)
+		return nil, 0, err
+	}
+
+	sm.recordFolderVersion(folder, version)
+
+	return secretData, version, nil
 }
 
 // Добавить в конфиг по определенному ключу определенное значение
@@ -139,14 +218,15 @@ func (sm *SecretManagerVault) putSingleSecretStringIntoTheConfig(key string, sec
 	defer sm.Unlock()
 
 	sm.config[key] = secretString
-	sm.logger.Infof("Updated secret in the config with keyToLookup %s to data '%s'", key, secretString)
+	sm.logger.Info("Updated secret in the config", "key", key)
 }
 
 // UpdateConfig берет полный конфиг из vault'a, и обновления вносит в текущий
 func (sm *SecretManagerVault) UpdateConfig() error {
 	cfg, err := sm.getFullConfigFromVault()
+	sm.recordRefresh(err)
 	if err != nil {
-		sm.logger.Errorf("Error getting config from Vault: %s", err.Error())
+		sm.logger.Error("Error getting config from Vault", "error", err)
 		return err
 	}
 
@@ -158,8 +238,13 @@ func (sm *SecretManagerVault) UpdateConfig() error {
 // ResetConfig берет полный конфиг из vault'a и старый конфиг заменяет на новый
 func (sm *SecretManagerVault) ResetConfig() error {
 	cfg, err := sm.getFullConfigFromVault()
+	sm.recordRefresh(err)
 	if err != nil {
-		sm.logger.Errorf("Error getting config from Vault: %s", err.Error())
+		if sm.cache != nil && isVaultUnreachable(err) && !sm.vaultLoaded() {
+			return sm.startFromConfigCache(err)
+		}
+
+		sm.logger.Error("Error getting config from Vault", "error", err)
 		return err
 	}
 
@@ -173,7 +258,7 @@ func (sm *SecretManagerVault) setConfig(cfg config) {
 	sm.Lock()
 	defer sm.Unlock()
 
-	sm.logger.Infof("setting new config")
+	sm.logger.Info("Setting new config", "keys", len(cfg))
 	sm.config = cfg
 }
 
@@ -183,29 +268,116 @@ func (sm *SecretManagerVault) setConfig(cfg config) {
 // ВЫПОЛНЕНИЯ БУДУТ ОШИБКИ. На выходе мы получаем СОВОКУПНУЮ ошибку, состоящую из нескольких ошибок.
 // Дальнейшие действия зависят от более высокой абстракции
 func (sm *SecretManagerVault) getFullConfigFromVault() (config, error) {
-	folderStack := make([]string, 0, 4)
-	folderStack = append(folderStack, "") // мы смотрим на базовый путь
+	startedAt := time.Now()
 
 	cumulativeConfig := config(make(map[string]any))
+	origins := make(map[string][]KeyOrigin)
+	trackExpiry := sm.expiryTrackingEnabled()
+	expiries := make([]SecretExpiry, 0)
+
+	overlayKeys := make(map[string]bool)
+	overlayShadowed := make(map[string]map[string]bool)
+
+	// ключ берется из первой папки, где он встретился, остальные попадают в коллизии. Базу, перекрытую оверлеем,
+	// помечаем отдельно: в Explain она видна, но это обычное переопределение, а не коллизия
+	merge := func(kv kvMount, folder string, folderConfig config) {
+		withOverlay := sm.overlay != nil && sm.overlay.environment != ""
+		for k, v := range folderConfig {
+			source := vaultSource(kv.dataPath() + folder)
+			origins[k] = append(origins[k], KeyOrigin{Level: LevelVault, Source: source, Value: v})
+
+			switch {
+			case withOverlay && kv == sm.kv:
+				overlayKeys[k] = true
+			case withOverlay && kv == sm.overlay.base && overlayKeys[k]:
+				if overlayShadowed[k] == nil {
+					overlayShadowed[k] = make(map[string]bool)
+				}
+				overlayShadowed[k][source] = true
+			}
+		}
+		mergeConfigs(cumulativeConfig, folderConfig)
+	}
+
+	errToReturn := sm.walkSecretFolders(func(folder string) error {
+		folderConfigUpdates, _, err := sm.getConfigFromVaultByPath(folder)
+		merge(sm.kv, folder, folderConfigUpdates)
+
+		if trackExpiry && err == nil {
+			if expiry, tagged := sm.readFolderExpiry(context.Background(), folder); tagged {
+				expiries = append(expiries, expiry)
+			}
+		}
+
+		if err != nil && !errors.Is(err, ErrEmptyVaultResponse) {
+			return err
+		}
+
+		return nil
+	})
+
+	// дополнительные пути слабее основного, среди них сильнее тот, что передан позже
+	for i := len(sm.vaultPaths) - 1; i >= 0; i-- {
+		kv := sm.vaultPaths[i]
+		err := sm.walkSecretFoldersIn(kv, func(folder string) error {
+			folderConfig, err := sm.readFolderConfig(kv, folder)
+			merge(kv, folder, folderConfig)
+
+			if err != nil && !errors.Is(err, ErrEmptyVaultResponse) {
+				return err
+			}
+
+			return nil
+		})
+		errToReturn = errors.Join(errToReturn, err)
+	}
+
+	if trackExpiry {
+		sm.recordExpiries(expiries)
+	}
+
+	if errToReturn == nil {
+		sm.sweepTransitCache()
+		sm.recordVaultOrigins(origins, overlayShadowed)
+		sm.writeConfigCache(cumulativeConfig)
+	}
+
+	sm.logger.Debug("Collected full config from Vault",
+		"folder", sm.basePath, "paths", len(sm.vaultPaths)+1, "keys", len(cumulativeConfig),
+		"duration", time.Since(startedAt), "error", errToReturn)
+
+	return cumulativeConfig, errToReturn
+}
+
+// walkSecretFolders обходит все папки под baseMetaPath в глубину и вызывает visit для каждого ключа листинга,
+// вложенные папки приходят с "/" на конце. Обход не останавливается на ошибках, они собираются в одну через errors.Join
+func (sm *SecretManagerVault) walkSecretFolders(visit func(folder string) error) error {
+	return sm.walkSecretFoldersIn(sm.kv, visit)
+}
+
+// walkSecretFoldersIn - walkSecretFolders по любому пути KV
+func (sm *SecretManagerVault) walkSecretFoldersIn(kv kvMount, visit func(folder string) error) error {
+	folderStack := make([]string, 0, 4)
+	folderStack = append(folderStack, "") // мы смотрим на базовый путь
 
 	var errToReturn error = nil
 	var currCheckedFolder string
 
 	for len(folderStack) > 0 {
 		currCheckedFolder = folderStack[len(folderStack)-1]
-		currCheckedPath := sm.baseMetaPath + currCheckedFolder
+		currCheckedPath := kv.metaPath() + currCheckedFolder
 		folderStack = folderStack[:len(folderStack)-1]
 
 		vaultResponseList, errList := sm.vaultClient.Logical().List(currCheckedPath)
 
 		if errList != nil {
-			sm.logger.Errorf("Error listing secrets folders at path '%s': %s", currCheckedPath, errList.Error())
+			sm.logger.Error("Error listing secrets folders", "folder", currCheckedPath, "error", errList)
 			errToReturn = errors.Join(errToReturn, errList)
 			continue
 		}
 
 		if vaultResponseList == nil || vaultResponseList.Data == nil {
-			sm.logger.Infof("Got nil while listing secrets folders at path '%s'", currCheckedPath)
+			sm.logger.Info("Got nil while listing secrets folders", "folder", currCheckedPath)
 			continue
 		}
 
@@ -214,31 +386,28 @@ func (sm *SecretManagerVault) getFullConfigFromVault() (config, error) {
 			folderString, okConversionToString := folder.(string)
 
 			if !okConversionToString {
-				sm.logger.Errorf("Error reading secret at folder '%s': failed to convert folder to string %s", folder, folderString)
+				sm.logger.Error("Error listing secrets folders: failed to convert folder to string", "folder", currCheckedPath, "value", folder)
 				errToReturn = errors.Join(errToReturn, ErrWhileConvertingToString)
 				continue
 			}
 
 			currInnerFolder = currCheckedFolder + folderString
-			folderConfigUpdates, err := sm.getConfigFromVaultByPath(currInnerFolder)
-			if err != nil && !errors.Is(err, ErrEmptyVaultResponse) {
+			if err := visit(currInnerFolder); err != nil {
 				errToReturn = errors.Join(errToReturn, err)
 			}
 
-			mergeConfigs(cumulativeConfig, folderConfigUpdates)
-
 			folderStack = append(folderStack, currInnerFolder)
 		}
 	}
 
-	return cumulativeConfig, errToReturn
+	return errToReturn
 }
 
 // UpdateConfigByPath Собирает обновления по пути, а далее вносит обновления в текущий конфиг
 func (sm *SecretManagerVault) UpdateConfigByPath(path string) error {
-	cfg, err := sm.getConfigFromVaultByPath(path)
+	cfg, _, err := sm.getConfigFromVaultByPath(path)
 	if err != nil {
-		sm.logger.Errorf("Error getting config from Vault: %s", err.Error())
+		sm.logger.Error("Error getting config from Vault", "error", err)
 		return err
 	}
 
@@ -249,65 +418,104 @@ func (sm *SecretManagerVault) UpdateConfigByPath(path string) error {
 
 // getConfigFromVaultByPath собирает конфиг по пути, который укажем, относительно базового пути. Если во время обновления произошла
 // хотя бы одна ошибка, изменения останавливаются, и возвращается тот конфиг, который был на момент ошибки.
-// Оставил глобальной для юзкейсов, когда мы точно ничего не удалили, а лишь обновили старые или добавили новые
-func (sm *SecretManagerVault) getConfigFromVaultByPath(path string) (config, error) {
-	vaultResponse, err := sm.vaultClient.Logical().Read(sm.basePath + path)
+// Оставил глобальной для юзкейсов, когда мы точно ничего не удалили, а лишь обновили старые или добавили новые.
+// Вторым значением отдается прочитанная версия папки, она же запоминается для SecretVersion.
+// Закрепленные через PinFolder папки читаются в закрепленной версии и в SecretVersion не попадают
+func (sm *SecretManagerVault) getConfigFromVaultByPath(path string) (config, int, error) {
+	pinned := sm.pinnedVersion(path)
+	secretData, version, err := sm.readSecret(context.Background(), path, pinned)
 
 	freshConfigByPath := config(make(map[string]any))
 
-	if err != nil {
-		sm.logger.Errorf("Error reading secrets at path '%s': %s", path, err.Error())
-		return freshConfigByPath, err
+	switch {
+	case errors.Is(err, ErrEmptyVaultResponse):
+		return freshConfigByPath, 0, err
+	case errors.Is(err, ErrNotMapInterface):
+		sm.logger.Error("Error reading secrets: failed to convert to map[string]interface{}", "folder", path)
+		return freshConfigByPath, 0, err
+	case err != nil:
+		sm.logger.Error("Error reading secrets", "folder", path, "error", err)
+		return freshConfigByPath, 0, err
 	}
 
-	if vaultResponse == nil || vaultResponse.Data == nil {
-		return freshConfigByPath, ErrEmptyVaultResponse
+	if err = sm.decodeFolderData(path, secretData, freshConfigByPath); err != nil {
+		return freshConfigByPath, version, err
 	}
 
-	secretData, okConversionToMapInterface := vaultResponse.Data["data"].(map[string]interface{})
-	if !okConversionToMapInterface {
-		sm.logger.Errorf("Error reading secrets at path '%s': failed to convert to map[string]interface{}", path)
-		return freshConfigByPath, ErrNotMapInterface
+	if pinned == 0 {
+		sm.recordFolderVersion(path, version)
 	}
 
+	return freshConfigByPath, version, nil
+}
+
+// decodeFolderData раскладывает прочитанную папку в cfg. json.Number оставляем как есть и разбираем только
+// при чтении через геттеры, иначе большие целые портятся при переводе во float64. Вложенные объекты и массивы
+// приходят уже с json.Number внутри. Шифротексты transit расшифровываются здесь же, если настроен ключ (SetTransitKey).
+// На первой ошибке останавливается, в cfg остается то, что успели разложить
+func (sm *SecretManagerVault) decodeFolderData(folder string, secretData map[string]any, cfg config) error {
 	for k, v := range secretData {
+		decoded, err := sm.decodeSecretValue(context.Background(), k, v)
+		if err != nil {
+			sm.logger.Error("Error decoding secret", "folder", folder, "key", k, "error", err)
+			return err
+		}
+		cfg[k] = decoded
+		sm.logger.Debug("Reading secret", "folder", folder, "key", k, "type", reflect.TypeOf(v))
+	}
 
-		switch v.(type) {
-		case json.Number:
-			freshConfigByPath[k], err = v.(json.Number).Float64()
+	return nil
+}
 
-			if err != nil {
-				sm.logger.Errorf("Error reading secret at path '%s': %s", path, err.Error())
-				return freshConfigByPath, err
-			}
-		default:
-			freshConfigByPath[k] = v
-			sm.logger.Debugf("Reading secret, which is not json.Number at path '%s', type %v", path, reflect.TypeOf(v))
-		}
+// SecretVersion - версия папки, которую менеджер видел при последнем чтении или записи.
+// false, если папку еще не читали или это KV v1, где версий нет
+func (sm *SecretManagerVault) SecretVersion(folder string) (int, bool) {
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	version, exists := sm.folderVersions[strings.Trim(folder, "/")]
+	return version, exists
+}
+
+func (sm *SecretManagerVault) recordFolderVersion(folder string, version int) {
+	if version == 0 {
+		return
 	}
 
-	return freshConfigByPath, nil
+	sm.stateMu.Lock()
+	defer sm.stateMu.Unlock()
+
+	sm.folderVersions[strings.Trim(folder, "/")] = version
 }
 
 func (sm *SecretManagerVault) applyUpdatesToConfig(configUpdates config) {
 	sm.Lock()
 	defer sm.Unlock()
 
-	sm.logger.Infof("applying updates to config: %v", configUpdates)
+	sm.logger.Info("Applying updates to config", "keys", len(configUpdates))
 	for k, v := range configUpdates {
 		sm.config[k] = v
 	}
 }
 
+// SetLenientConversion включает мягкий режим для всех геттеров: строковые значения, например записанные через UI,
+// разбираются в запрошенный тип. По умолчанию режим строгий. Для отдельного вызова режим переключается
+// через Lenient()/Strict(), но только в геттерах по пути (GetString, GetInt и т.д.)
+func (sm *SecretManagerVault) SetLenientConversion(enabled bool) {
+	sm.Lock()
+	defer sm.Unlock()
+
+	sm.lenientConversion = enabled
+}
+
 func (sm *SecretManagerVault) GetSecretStringFromConfig(key string) (string, error) {
 	sm.RLock()
 	defer sm.RUnlock()
-	if value, exists := sm.config[key]; exists {
-		valueStr, ok := value.(string)
-
-		if !ok {
-			sm.logger.Errorf("Error reading secret at path '%s': failed to convert to string", key)
-			return "", ErrWhileConvertingToString
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		valueStr, err := toString(value, sm.lenientConversion || fromStrings)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return "", err
 		}
 
 		return valueStr, nil
@@ -318,31 +526,27 @@ func (sm *SecretManagerVault) GetSecretStringFromConfig(key string) (string, err
 func (sm *SecretManagerVault) GetSecretBoolFromConfig(key string) (bool, error) {
 	sm.RLock()
 	defer sm.RUnlock()
-	if value, exists := sm.config[key]; exists {
-		boolVal, ok := value.(bool)
-		if !ok {
-			sm.logger.Errorf("Error reading secret at path '%s': failed to convert to bool", key)
-			return false, ErrWhileConvertingToBool
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		boolVal, err := toBool(value, sm.lenientConversion || fromStrings)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return false, err
 		}
 		return boolVal, nil
 	}
 	return false, ErrKeyNotFound
 }
 
+// GetSecretIntFromConfig возвращает целое без потерь: дробные значения и значения вне диапазона int дают ошибку,
+// а не молча обрезаются
 func (sm *SecretManagerVault) GetSecretIntFromConfig(key string) (int, error) {
 	sm.RLock()
 	defer sm.RUnlock()
-	if value, exists := sm.config[key]; exists {
-
-		var intVal int
-		switch value.(type) {
-		case float64:
-			intVal = int(value.(float64))
-		case int:
-			intVal = value.(int)
-		default:
-			sm.logger.Errorf("Error reading secret for key %s from config: failed to convert to int", key)
-			return 0, ErrWhileConvertingToInt
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		intVal, err := toInt(value, sm.lenientConversion || fromStrings)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return 0, err
 		}
 
 		return intVal, nil
@@ -350,14 +554,44 @@ func (sm *SecretManagerVault) GetSecretIntFromConfig(key string) (int, error) {
 	return 0, ErrKeyNotFound
 }
 
+func (sm *SecretManagerVault) GetSecretInt64FromConfig(key string) (int64, error) {
+	sm.RLock()
+	defer sm.RUnlock()
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		intVal, err := toInt64(value, sm.lenientConversion || fromStrings, ErrWhileConvertingToInt64)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return 0, err
+		}
+
+		return intVal, nil
+	}
+	return 0, ErrKeyNotFound
+}
+
+func (sm *SecretManagerVault) GetSecretUint64FromConfig(key string) (uint64, error) {
+	sm.RLock()
+	defer sm.RUnlock()
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		uintVal, err := toUint64(value, sm.lenientConversion || fromStrings, ErrWhileConvertingToUint64)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return 0, err
+		}
+
+		return uintVal, nil
+	}
+	return 0, ErrKeyNotFound
+}
+
 func (sm *SecretManagerVault) GetSecretFloat64FromConfig(key string) (float64, error) {
 	sm.RLock()
 	defer sm.RUnlock()
-	if value, exists := sm.config[key]; exists {
-		floatVal, ok := value.(float64)
-		if !ok {
-			sm.logger.Errorf("Error reading secret at path '%s': failed to convert to float64", key)
-			return 0, ErrWhileConvertingToFloat
+	if value, fromStrings, exists := sm.valueLocked(key); exists {
+		floatVal, err := toFloat64(value, sm.lenientConversion || fromStrings)
+		if err != nil {
+			sm.logger.Error("Error reading secret from config", "key", key, "error", err)
+			return 0, err
 		}
 		return floatVal, nil
 	}
@@ -388,40 +622,83 @@ func (sm *SecretManagerVault) getConfigCopy() config {
 	return configCopy
 }
 
+// resetUpdaterBaseline - апдейтер считает текущий конфиг уже известным подписчикам
+func (sm *SecretManagerVault) resetUpdaterBaseline() {
+	configCopy := sm.getConfigCopy()
+
+	sm.Lock()
+	defer sm.Unlock()
+
+	sm.updaterBaseline = configCopy
+}
+
+func (sm *SecretManagerVault) differsFromUpdaterBaseline(freshConfig config) bool {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	return areConfigsDifferent(freshConfig, sm.updaterBaseline)
+}
+
+// refreshForUpdater перечитывает конфиг для апдейтера и ставит его, если он отличается от того, о котором
+// апдейтер уже уведомил. Возвращает, надо ли уведомлять
+func (sm *SecretManagerVault) refreshForUpdater(attempt int) bool {
+	sm.refreshMu.Lock()
+	defer sm.refreshMu.Unlock()
+
+	startedAt := time.Now()
+	freshConfig, err := sm.getFullConfigFromVault()
+	sm.recordRefresh(err)
+
+	if err != nil || freshConfig == nil {
+		sm.logger.Error("getFullConfigFromVault failed in configUpdater or freshConfig is nil",
+			"attempt", attempt, "duration", time.Since(startedAt), "error", err, "freshConfigIsNil", freshConfig == nil)
+		return false
+	}
+
+	sm.logger.Debug("Config collected in configUpdater", "attempt", attempt, "duration", time.Since(startedAt))
+
+	if !sm.differsFromUpdaterBaseline(freshConfig) {
+		return false
+	}
+
+	sm.setConfig(freshConfig)
+	sm.resetUpdaterBaseline()
+
+	return true
+}
+
 func (sm *SecretManagerVault) StartConfigUpdater(updateInterval time.Duration) {
-	defer close(sm.notifier)
+	defer sm.closeNotifier()
 
 	ticker := time.NewTicker(updateInterval)
 	defer ticker.Stop()
 
-	configCopy := sm.getConfigCopy()
+	sm.resetUpdaterBaseline()
+	attempt := 0
 
 	for {
 		select {
 		case <-sm.stopChan:
 			return
 		case <-ticker.C:
-			freshConfig, err := sm.getFullConfigFromVault()
-
-			if err != nil || freshConfig == nil {
-				sm.logger.Errorf("getFullConfigFromVault failed in configUpdater or freshConfig is nil, err = %v, freshConfig = %v", err, freshConfig)
+			attempt++
+			if sm.refreshPaused() {
+				sm.logger.Info("Vault is sealed, skipping config update", "attempt", attempt)
 				continue
 			}
 
-			if !areConfigsDifferent(freshConfig, configCopy) {
+			if !sm.refreshForUpdater(attempt) {
 				continue
 			}
 
-			sm.setConfig(freshConfig)
-			configCopy = sm.getConfigCopy()
-
+			// остановленный апдейтер уже не уведомляет, даже если успел собрать новый конфиг
 			select {
-			case sm.notifier <- struct{}{}:
 			case <-sm.stopChan:
 				return
 			default:
-				sm.logger.Infof("configUpdater notifier blocked, cant send notification")
 			}
+
+			sm.notifyChange()
 		}
 	}
 }
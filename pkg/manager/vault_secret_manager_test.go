@@ -1,8 +1,12 @@
 package manager
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"math"
 	"os"
 	"testing"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go/modules/vault"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 const (
@@ -19,7 +24,8 @@ const (
 )
 
 var (
-	nilLogger = zap.NewNop().Sugar()
+	nilLogger    = NewNopLogger()
+	nilZapLogger = zap.NewNop().Sugar()
 )
 
 var newManagerTests = []struct {
@@ -36,7 +42,7 @@ func TestNewSecretManager(t *testing.T) {
 	var sm *SecretManagerVault
 	var err error
 	for _, test := range newManagerTests {
-		sm, err = NewSecretManager(test.address, test.token, testBasePathData, testBasePathMetadata, nilLogger)
+		sm, err = NewSecretManager(test.address, test.token, testBasePathData, testBasePathMetadata, nilZapLogger)
 		assert.Equal(t, test.expectedErr, err)
 		if test.expectedErr == nil {
 			assert.NotNil(t, sm)
@@ -146,7 +152,7 @@ func TestIntegrityWithVaultContainer(t *testing.T) {
 		vaultContainer.Terminate(ctx)
 	})
 
-	sm, errSmInit := NewSecretManager(endpoint, testVaultToken, testBasePathData, testBasePathMetadata, nilLogger)
+	sm, errSmInit := NewSecretManager(endpoint, testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
 	require.NoError(t, errSmInit)
 
 	var retrievedString string
@@ -231,7 +237,7 @@ var putSingleSecretStringTests = []struct {
 }
 
 func TestPutSecretString(t *testing.T) {
-	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilLogger)
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
 
 	for _, test := range putSingleSecretStringTests {
 		sm.putSingleSecretStringIntoTheConfig(test.key, test.value)
@@ -257,7 +263,7 @@ var applyUpdatesToConfigTests = []struct {
 }
 
 func TestApplyUpdatesToConfigAndPurge(t *testing.T) {
-	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilLogger)
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
 
 	for _, test := range applyUpdatesToConfigTests {
 		sm.applyUpdatesToConfig(test.configUpdates)
@@ -312,7 +318,7 @@ var getSecretValuesTests = []struct {
 }
 
 func TestGetFromConfig(t *testing.T) {
-	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilLogger)
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
 
 	for _, test := range getSecretValuesTests {
 		t.Run(test.name, func(t *testing.T) {
@@ -335,3 +341,157 @@ func TestGetFromConfig(t *testing.T) {
 		})
 	}
 }
+
+var getNumericValuesTests = []struct {
+	name        string
+	value       any
+	testCase    int // 0 - int, 1 - int64, 2 - uint64, 3 - float64
+	expected    any
+	expectedErr error
+}{
+	{"int from json.Number", json.Number("8080"), 0, 8080, nil},
+	{"int from integral float64", float64(42), 0, 42, nil},
+	{"int from fractional json.Number", json.Number("3.7"), 0, 0, ErrValueNotIntegral},
+	{"int from exponent json.Number", json.Number("1e3"), 0, 1000, nil},
+	{"int64 beyond float64 precision", json.Number("9007199254740993"), 1, int64(9007199254740993), nil},
+	{"int64 max", json.Number("9223372036854775807"), 1, int64(math.MaxInt64), nil},
+	{"int64 overflow", json.Number("9223372036854775808"), 1, int64(0), ErrValueOutOfRange},
+	{"uint64 max", json.Number("18446744073709551615"), 2, uint64(math.MaxUint64), nil},
+	{"uint64 negative", json.Number("-1"), 2, uint64(0), ErrValueOutOfRange},
+	{"int from string", "8080", 0, 0, ErrWhileConvertingToInt},
+	{"float64 from json.Number", json.Number("1.5"), 3, 1.5, nil},
+	{"float64 overflow", json.Number("1e400"), 3, float64(0), ErrValueOutOfRange},
+	{"float64 from uint64", uint64(math.MaxUint64), 3, float64(math.MaxUint64), nil},
+}
+
+func TestGetNumericFromConfig(t *testing.T) {
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+
+	for _, test := range getNumericValuesTests {
+		t.Run(test.name, func(t *testing.T) {
+			sm.config = config{"num": test.value}
+
+			var val any
+			var err error
+			switch test.testCase {
+			case 0:
+				val, err = sm.GetSecretIntFromConfig("num")
+			case 1:
+				val, err = sm.GetSecretInt64FromConfig("num")
+			case 2:
+				val, err = sm.GetSecretUint64FromConfig("num")
+			case 3:
+				val, err = sm.GetSecretFloat64FromConfig("num")
+			}
+
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.Equal(t, test.expected, val)
+		})
+	}
+}
+
+var getLenientValuesTests = []struct {
+	name           string
+	value          any
+	testCase       int // 0 - bool, 1 - int, 2 - float64, 3 - string
+	managerLenient bool
+	opts           []GetOption
+	expected       any
+	expectedErr    error
+}{
+	{"strict by default", "true", 0, false, nil, false, ErrWhileConvertingToBool},
+	{"lenient per call bool", "true", 0, false, []GetOption{Lenient()}, true, nil},
+	{"lenient per manager int", "8080", 1, true, nil, 8080, nil},
+	{"strict per call overrides manager", "8080", 1, true, []GetOption{Strict()}, 0, ErrWhileConvertingToInt},
+	{"lenient fractional int", "1.5", 1, true, nil, 0, ErrValueNotIntegral},
+	{"lenient bad int syntax", "80a", 1, true, nil, 0, ErrInvalidSyntax},
+	{"lenient fraction int", "4/2", 1, true, nil, 0, ErrInvalidSyntax},
+	{"lenient hex int", "0x1F", 1, true, nil, 0, ErrInvalidSyntax},
+	{"lenient fraction float64", "1/3", 2, true, nil, float64(0), ErrInvalidSyntax},
+	{"lenient infinity float64", "Inf", 2, true, nil, float64(0), ErrInvalidSyntax},
+	{"lenient exponent int", "1e3", 1, true, nil, 1000, nil},
+	{"lenient bad bool syntax", "yes please", 0, true, nil, false, ErrInvalidSyntax},
+	{"lenient float64", " 1.5 ", 2, true, nil, 1.5, nil},
+	{"lenient string from number", json.Number("8080"), 3, true, nil, "8080", nil},
+	{"strict string from number", json.Number("8080"), 3, false, nil, "", ErrWhileConvertingToString},
+	{"lenient string from uint64", uint64(math.MaxUint64), 3, true, nil, "18446744073709551615", nil},
+}
+
+func TestGetLenientFromConfig(t *testing.T) {
+	sm, _ := NewSecretManager("", testVaultToken, testBasePathData, testBasePathMetadata, nilZapLogger)
+
+	for _, test := range getLenientValuesTests {
+		t.Run(test.name, func(t *testing.T) {
+			sm.config = config{"val": test.value}
+			sm.SetLenientConversion(test.managerLenient)
+
+			var val, keyVal any
+			var err, keyErr error
+			switch test.testCase {
+			case 0:
+				val, err = sm.GetBool("val", test.opts...)
+				keyVal, keyErr = sm.GetSecretBoolFromConfig("val")
+			case 1:
+				val, err = sm.GetInt("val", test.opts...)
+				keyVal, keyErr = sm.GetSecretIntFromConfig("val")
+			case 2:
+				val, err = sm.GetFloat64("val", test.opts...)
+				keyVal, keyErr = sm.GetSecretFloat64FromConfig("val")
+			case 3:
+				val, err = sm.GetString("val", test.opts...)
+				keyVal, keyErr = sm.GetSecretStringFromConfig("val")
+			}
+
+			// GetSecret*FromConfig опций не принимают и работают в режиме менеджера
+			if test.opts == nil {
+				assert.Equal(t, val, keyVal)
+				assert.Equal(t, err, keyErr)
+			}
+
+			assert.True(t, errors.Is(err, test.expectedErr), "got error %v", err)
+			assert.Equal(t, test.expected, val)
+		})
+	}
+}
+
+func TestStructuredLogging(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	sm, err := NewSecretManagerWithOptions(
+		WithAddress(fv.server.URL),
+		WithToken(testVaultToken),
+		WithBasePaths(testBasePathData, testBasePathMetadata),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	_, err = sm.UpdateSpecificSecret("missing/", "db_password")
+	assert.True(t, errors.Is(err, ErrEmptyVaultResponse))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "missing/", entry["folder"])
+	assert.Equal(t, "db_password", entry["key"])
+}
+
+func TestZapLogging(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.addMount("kv", KVVersion2)
+
+	core, logs := observer.New(zap.InfoLevel)
+
+	// старые вызовы с *zap.SugaredLogger продолжают работать
+	sm, err := NewSecretManager(fv.server.URL, testVaultToken, testBasePathData, testBasePathMetadata, zap.New(core).Sugar())
+	require.NoError(t, err)
+
+	_, err = sm.UpdateSpecificSecret("missing/", "db_password")
+	assert.True(t, errors.Is(err, ErrEmptyVaultResponse))
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]any{"folder": "missing/", "key": "db_password"}, entries[0].ContextMap())
+}
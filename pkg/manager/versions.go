@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrVersionsNotSupported = errors.New("secret versions are supported only on kv v2 mounts")
+	ErrNotConfirmed         = errors.New("destructive operation is not confirmed")
+	ErrInvalidVersion       = errors.New("invalid secret version")
+)
+
+// SecretVersionMetadata - метаданные одной версии папки, как их отдает KV v2
+type SecretVersionMetadata struct {
+	Version      int
+	CreatedTime  time.Time
+	DeletionTime time.Time // нулевое, если версия не удалена
+	Destroyed    bool
+	Current      bool
+}
+
+// Deleted - версия мягко удалена и ее можно вернуть через UndeleteSecretVersions
+func (m SecretVersionMetadata) Deleted() bool {
+	return !m.DeletionTime.IsZero() && !m.Destroyed
+}
+
+// ListSecretVersions отдает все версии папки, которые хранит vault, по возрастанию номера
+func (sm *SecretManagerVault) ListSecretVersions(ctx context.Context, folder string) ([]SecretVersionMetadata, error) {
+	if sm.kv.version == KVVersion1 {
+		return nil, ErrVersionsNotSupported
+	}
+
+	resp, err := sm.vaultClient.Logical().ReadWithContext(ctx, sm.baseMetaPath+folder)
+	if err != nil {
+		sm.logger.Error("Error reading secret metadata", "folder", folder, "error", err)
+		return nil, err
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, ErrEmptyVaultResponse
+	}
+
+	current := versionFromAny(resp.Data["current_version"])
+	rawVersions, _ := resp.Data["versions"].(map[string]any)
+
+	versions := make([]SecretVersionMetadata, 0, len(rawVersions))
+	for number, raw := range rawVersions {
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			sm.logger.Warn("Skipping secret version with a non-numeric name", "folder", folder, "version", number)
+			continue
+		}
+
+		fields, _ := raw.(map[string]any)
+		destroyed, _ := fields["destroyed"].(bool)
+
+		versions = append(versions, SecretVersionMetadata{
+			Version:      version,
+			CreatedTime:  parseVaultTime(fields["created_time"]),
+			DeletionTime: parseVaultTime(fields["deletion_time"]),
+			Destroyed:    destroyed,
+			Current:      version == current,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// ReadSecretVersion читает конкретную версию папки. Удаленная или уничтоженная версия - ErrEmptyVaultResponse
+func (sm *SecretManagerVault) ReadSecretVersion(ctx context.Context, folder string, version int) (map[string]any, error) {
+	if sm.kv.version == KVVersion1 {
+		return nil, ErrVersionsNotSupported
+	}
+
+	if version < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidVersion, version)
+	}
+
+	secretData, _, err := sm.readSecret(ctx, folder, version)
+	if err != nil {
+		sm.logger.Error("Error reading secret version", "folder", folder, "version", version, "error", err)
+		return nil, err
+	}
+
+	return secretData, nil
+}
+
+// DiffSecretVersions - что поменялось в папке от версии from к версии to
+func (sm *SecretManagerVault) DiffSecretVersions(ctx context.Context, folder string, from, to int) ([]KeyChange, error) {
+	fromData, err := sm.ReadSecretVersion(ctx, folder, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toData, err := sm.ReadSecretVersion(ctx, folder, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffConfigs(fromData, toData), nil
+}
+
+// RollbackSecret записывает данные старой версии как новую текущую и возвращает номер новой версии.
+// История не переписывается: откат - такая же запись, как PutSecret, поэтому работают UpdateLocalConfig и WithCAS
+func (sm *SecretManagerVault) RollbackSecret(ctx context.Context, folder string, version int, opts ...WriteOption) (int, error) {
+	oldData, err := sm.ReadSecretVersion(ctx, folder, version)
+	if err != nil {
+		return 0, err
+	}
+
+	newVersion, err := sm.PutSecret(ctx, folder, oldData, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	sm.logger.Info("Secret rolled back", "folder", folder, "from_version", version, "version", newVersion)
+
+	return newVersion, nil
+}
+
+// DeleteSecretVersions мягко удаляет версии папки, их можно вернуть через UndeleteSecretVersions.
+// confirmFolder должен совпадать с folder - защита от удаления не той папки по ошибке
+func (sm *SecretManagerVault) DeleteSecretVersions(ctx context.Context, folder string, versions []int, confirmFolder string) error {
+	return sm.changeSecretVersions(ctx, "delete", folder, versions, confirmFolder)
+}
+
+// UndeleteSecretVersions возвращает мягко удаленные версии
+func (sm *SecretManagerVault) UndeleteSecretVersions(ctx context.Context, folder string, versions []int) error {
+	return sm.changeSecretVersions(ctx, "undelete", folder, versions, folder)
+}
+
+// DestroySecretVersions безвозвратно уничтожает данные версий, метаданные остаются.
+// confirmFolder должен совпадать с folder, как в DeleteSecretVersions
+func (sm *SecretManagerVault) DestroySecretVersions(ctx context.Context, folder string, versions []int, confirmFolder string) error {
+	return sm.changeSecretVersions(ctx, "destroy", folder, versions, confirmFolder)
+}
+
+func (sm *SecretManagerVault) changeSecretVersions(
+	ctx context.Context,
+	route string,
+	folder string,
+	versions []int,
+	confirmFolder string,
+) error {
+	if sm.kv.version == KVVersion1 {
+		return ErrVersionsNotSupported
+	}
+
+	if confirmFolder != folder {
+		return fmt.Errorf("%w: %s of %q requires the folder name as confirmation", ErrNotConfirmed, route, folder)
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("%w: no versions to %s", ErrInvalidVersion, route)
+	}
+
+	for _, version := range versions {
+		if version < 1 {
+			return fmt.Errorf("%w: %d", ErrInvalidVersion, version)
+		}
+	}
+
+	_, err := sm.vaultClient.Logical().WriteWithContext(ctx, sm.kv.versionsPath(route)+folder, map[string]any{"versions": versions})
+	if err != nil {
+		sm.logger.Error("Error changing secret versions", "operation", route, "folder", folder, "versions", versions, "error", err)
+		return err
+	}
+
+	sm.logger.Info("Secret versions changed", "operation", route, "folder", folder, "versions", versions)
+
+	return nil
+}
+
+// parseVaultTime разбирает время из метаданных vault'a, пустая строка - нулевое время
+func parseVaultTime(raw any) time.Time {
+	value, _ := raw.(string)
+	if value == "" {
+		return time.Time{}
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return parsed
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretVersionsAndRollback(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	fv.putSecret("kv/main/db", map[string]any{"db_user": "app", "db_password": "broken"})
+
+	versions, err := sm.ListSecretVersions(ctx, "db")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.False(t, versions[0].Current)
+	assert.True(t, versions[1].Current)
+	assert.False(t, versions[1].CreatedTime.IsZero())
+
+	old, err := sm.ReadSecretVersion(ctx, "db", 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"db_user": "app", "db_password": "old"}, old)
+
+	diff, err := sm.DiffSecretVersions(ctx, "db", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []KeyChange{{Key: "db_password", Kind: ChangeModified, Old: "old", New: "broken"}}, diff)
+
+	version, err := sm.RollbackSecret(ctx, "db", 1, UpdateLocalConfig())
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, "old", fv.secretData("kv/main/db")["db_password"])
+	assert.Equal(t, "old", sm.config["db_password"])
+
+	_, err = sm.ReadSecretVersion(ctx, "db", 10)
+	assert.True(t, errors.Is(err, ErrEmptyVaultResponse))
+}
+
+var secretVersionsConfirmationTests = []struct {
+	name          string
+	confirmFolder string
+	versions      []int
+	expectedErr   error
+}{
+	{"not confirmed", "", []int{1}, ErrNotConfirmed},
+	{"wrong folder", "kafka", []int{1}, ErrNotConfirmed},
+	{"no versions", "db", nil, ErrInvalidVersion},
+	{"bad version", "db", []int{0}, ErrInvalidVersion},
+}
+
+func TestSecretVersionsConfirmation(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	for _, test := range secretVersionsConfirmationTests {
+		t.Run(test.name, func(t *testing.T) {
+			err := sm.DeleteSecretVersions(context.Background(), "db", test.versions, test.confirmFolder)
+			assert.True(t, errors.Is(err, test.expectedErr))
+
+			err = sm.DestroySecretVersions(context.Background(), "db", test.versions, test.confirmFolder)
+			assert.True(t, errors.Is(err, test.expectedErr))
+		})
+	}
+}
+
+func TestDeleteUndeleteDestroyVersions(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	require.NoError(t, sm.DeleteSecretVersions(ctx, "db", []int{1}, "db"))
+	assert.Nil(t, fv.secretData("kv/main/db"))
+
+	versions, err := sm.ListSecretVersions(ctx, "db")
+	require.NoError(t, err)
+	assert.True(t, versions[0].Deleted())
+
+	// удаленная папка не ломает полное обновление конфига
+	require.NoError(t, sm.ReloadConfig())
+	assert.Equal(t, config{"brokers": "b1:9092"}, sm.config)
+
+	require.NoError(t, sm.UndeleteSecretVersions(ctx, "db", []int{1}))
+	assert.Equal(t, "old", fv.secretData("kv/main/db")["db_password"])
+
+	require.NoError(t, sm.DestroySecretVersions(ctx, "db", []int{1}, "db"))
+	versions, err = sm.ListSecretVersions(ctx, "db")
+	require.NoError(t, err)
+	assert.True(t, versions[0].Destroyed)
+	assert.False(t, versions[0].Deleted())
+
+	_, err = sm.ReadSecretVersion(ctx, "db", 1)
+	assert.True(t, errors.Is(err, ErrEmptyVaultResponse))
+}
+
+func TestSecretVersionsKVv1(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup.withKVVersion(KVVersion1))
+
+	_, err := sm.ListSecretVersions(context.Background(), "db")
+	assert.True(t, errors.Is(err, ErrVersionsNotSupported))
+
+	err = sm.DestroySecretVersions(context.Background(), "db", []int{1}, "db")
+	assert.True(t, errors.Is(err, ErrVersionsNotSupported))
+}
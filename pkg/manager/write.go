@@ -0,0 +1,294 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	ErrPatchNotSupported = errors.New("patch is supported only on kv v2 mounts")
+	ErrCASNotSupported   = errors.New("check-and-set is supported only for put and patch on kv v2 mounts")
+	ErrCASConflict       = errors.New("check-and-set version mismatch")
+)
+
+// CASConflictError - запись с WithCAS не прошла, потому что папку успели изменить. Проверять через
+// errors.Is(err, ErrCASConflict), подробности - через errors.As
+type CASConflictError struct {
+	Folder          string
+	ExpectedVersion int
+	CurrentVersion  int
+
+	// Diff - что поменялось в папке между ExpectedVersion и CurrentVersion, то есть чужие изменения,
+	// которые затерла бы наша запись. Пустой, если прочитать версии не получилось
+	Diff []KeyChange
+
+	Err error
+}
+
+func (e *CASConflictError) Error() string {
+	return fmt.Sprintf("%s: folder %q: expected version %d, current version %d: %s",
+		ErrCASConflict, e.Folder, e.ExpectedVersion, e.CurrentVersion, e.Err)
+}
+
+func (e *CASConflictError) Unwrap() []error {
+	return []error{ErrCASConflict, e.Err}
+}
+
+// WriteOption - настройка для PutSecret, PatchSecret и DeleteSecret
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	updateLocal bool
+	cas         *int
+}
+
+// UpdateLocalConfig - после успешной записи сразу перечитать конфиг целиком и, если он поменялся, отправить
+// уведомление в GetNotifierChannel, не дожидаясь апдейтера
+func UpdateLocalConfig() WriteOption {
+	return func(o *writeOptions) {
+		o.updateLocal = true
+	}
+}
+
+// WithCAS - записать, только если текущая версия папки равна version (KV v2 options.cas). Версию отдают
+// ReadSecret, UpdateSpecificSecretWithVersion и SecretVersion, 0 значит "только если папки еще нет".
+// При несовпадении возвращается *CASConflictError
+func WithCAS(version int) WriteOption {
+	return func(o *writeOptions) {
+		o.cas = &version
+	}
+}
+
+func buildWriteOptions(opts []WriteOption) writeOptions {
+	o := writeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// PutSecret целиком заменяет содержимое папки относительно basePath. Возвращает новую версию секрета (0 для KV v1)
+func (sm *SecretManagerVault) PutSecret(ctx context.Context, folder string, data map[string]any, opts ...WriteOption) (int, error) {
+	o := buildWriteOptions(opts)
+	if o.cas != nil && sm.kv.version == KVVersion1 {
+		return 0, ErrCASNotSupported
+	}
+
+	resp, err := sm.writeSecretData(ctx, folder, data, o.kvOptions())
+	if err != nil {
+		sm.logger.Error("Error writing secret", "folder", folder, "error", err)
+		return 0, sm.checkCASConflict(ctx, folder, o, err)
+	}
+
+	version := versionFromWriteResponse(resp)
+	sm.recordFolderVersion(folder, version)
+	sm.logger.Info("Secret written", "folder", folder, "version", version, "keys", len(data))
+
+	if o.updateLocal {
+		sm.applyWriteToConfig(folder)
+	}
+
+	return version, nil
+}
+
+// PatchSecret применяет JSON merge patch (RFC 7386) к последней версии папки: ключи из patch перезаписываются,
+// вложенные объекты сливаются, ключи со значением nil удаляются на любой глубине, остальные остаются как были. Только для KV v2
+func (sm *SecretManagerVault) PatchSecret(ctx context.Context, folder string, patch map[string]any, opts ...WriteOption) (int, error) {
+	if sm.kv.version == KVVersion1 {
+		return 0, ErrPatchNotSupported
+	}
+
+	o := buildWriteOptions(opts)
+
+	payload := map[string]any{"data": patch}
+	if options := o.kvOptions(); options != nil {
+		payload["options"] = options
+	}
+
+	resp, err := sm.vaultClient.Logical().JSONMergePatch(ctx, sm.basePath+folder, payload)
+	if err != nil {
+		sm.logger.Error("Error patching secret", "folder", folder, "error", err)
+		return 0, sm.checkCASConflict(ctx, folder, o, err)
+	}
+
+	version := versionFromWriteResponse(resp)
+	sm.recordFolderVersion(folder, version)
+	sm.logger.Info("Secret patched", "folder", folder, "version", version, "keys", len(patch))
+
+	if o.updateLocal {
+		sm.applyWriteToConfig(folder)
+	}
+
+	return version, nil
+}
+
+// DeleteSecret удаляет папку. В KV v2 это мягкое удаление последней версии, ее можно восстановить.
+// vault не умеет CAS для удаления, поэтому WithCAS здесь дает ErrCASNotSupported
+func (sm *SecretManagerVault) DeleteSecret(ctx context.Context, folder string, opts ...WriteOption) error {
+	o := buildWriteOptions(opts)
+	if o.cas != nil {
+		return ErrCASNotSupported
+	}
+
+	if _, err := sm.vaultClient.Logical().DeleteWithContext(ctx, sm.basePath+folder); err != nil {
+		sm.logger.Error("Error deleting secret", "folder", folder, "error", err)
+		return err
+	}
+
+	sm.logger.Info("Secret deleted", "folder", folder)
+
+	if o.updateLocal {
+		sm.applyWriteToConfig(folder)
+	}
+
+	return nil
+}
+
+func (o writeOptions) kvOptions() map[string]any {
+	if o.cas == nil {
+		return nil
+	}
+
+	return map[string]any{"cas": *o.cas}
+}
+
+// checkCASConflict превращает отказ vault'a по CAS в *CASConflictError: узнает текущую версию по метаданным
+// и собирает дифф между версией, которую ждал вызывающий, и текущей. Остальные ошибки отдаются как есть
+func (sm *SecretManagerVault) checkCASConflict(ctx context.Context, folder string, o writeOptions, err error) error {
+	var respErr *vaultapi.ResponseError
+	if o.cas == nil || !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+
+	isCASError := false
+	for _, message := range respErr.Errors {
+		if strings.Contains(message, "check-and-set") {
+			isCASError = true
+			break
+		}
+	}
+	if !isCASError {
+		return err
+	}
+
+	conflict := &CASConflictError{Folder: folder, ExpectedVersion: *o.cas, Err: err}
+
+	metadata, metaErr := sm.vaultClient.Logical().ReadWithContext(ctx, sm.baseMetaPath+folder)
+	if metaErr != nil || metadata == nil || metadata.Data == nil {
+		sm.logger.Warn("Error reading secret metadata after cas conflict", "folder", folder, "error", metaErr)
+		return conflict
+	}
+	conflict.CurrentVersion = versionFromAny(metadata.Data["current_version"])
+
+	var expectedData, currentData map[string]any
+	if conflict.ExpectedVersion > 0 {
+		expectedData, _, metaErr = sm.readSecret(ctx, folder, conflict.ExpectedVersion)
+		if metaErr != nil && !errors.Is(metaErr, ErrEmptyVaultResponse) {
+			sm.logger.Warn("Error reading expected version after cas conflict", "folder", folder, "error", metaErr)
+			return conflict
+		}
+	}
+	currentData, _, metaErr = sm.readSecret(ctx, folder, conflict.CurrentVersion)
+	if metaErr != nil && !errors.Is(metaErr, ErrEmptyVaultResponse) {
+		sm.logger.Warn("Error reading current version after cas conflict", "folder", folder, "error", metaErr)
+		return conflict
+	}
+
+	conflict.Diff = DiffConfigs(expectedData, currentData)
+	sm.recordFolderVersion(folder, conflict.CurrentVersion)
+
+	return conflict
+}
+
+// applyWriteToConfig переносит запись в текущий конфиг, перечитывая его целиком. Ключ папки может быть перекрыт
+// другой папкой, путем из WithVaultPaths или оверлеем, а после удаления - все еще лежать в базе, так что правильный
+// результат дает только полный merge, тот же, что у апдейтера. Базу апдейтера правим вместе с конфигом,
+// чтобы одна запись не давала второе уведомление
+func (sm *SecretManagerVault) applyWriteToConfig(folder string) {
+	if pinned := sm.pinnedVersion(folder); pinned != 0 {
+		sm.logger.Info("Folder is pinned, written secret is not applied to config", "folder", folder, "version", pinned)
+		return
+	}
+
+	sm.refreshMu.Lock()
+	defer sm.refreshMu.Unlock()
+
+	freshConfig, err := sm.getFullConfigFromVault()
+	sm.recordRefresh(err)
+	if err != nil {
+		sm.logger.Warn("Error rereading config after write, it will be applied by the next update", "folder", folder, "error", err)
+		return
+	}
+
+	sm.Lock()
+	changed := areConfigsDifferent(freshConfig, sm.config)
+	sm.config = freshConfig
+	if sm.updaterBaseline != nil {
+		sm.updaterBaseline = maps.Clone(freshConfig)
+	}
+	sm.Unlock()
+
+	sm.logger.Info("Applied written secret to config", "folder", folder, "changed", changed)
+	if changed {
+		sm.notifyChange()
+	}
+}
+
+// versionFromWriteResponse достает номер версии из ответа на запись в KV v2. Для v1 ответа нет - версия 0
+func versionFromWriteResponse(resp *vaultapi.Secret) int {
+	if resp == nil || resp.Data == nil {
+		return 0
+	}
+
+	return versionFromAny(resp.Data["version"])
+}
+
+func versionFromAny(raw any) int {
+	switch v := raw.(type) {
+	case json.Number:
+		version, _ := strconv.Atoi(v.String())
+		return version
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// notifyChange неблокирующе шлет уведомление в канал, который отдает GetNotifierChannel.
+// Если апдейтер уже остановлен и закрыл канал, уведомлять некого
+func (sm *SecretManagerVault) notifyChange() {
+	sm.notifierMu.Lock()
+	defer sm.notifierMu.Unlock()
+
+	if sm.notifierClosed {
+		return
+	}
+
+	select {
+	case sm.notifier <- struct{}{}:
+	default:
+		sm.logger.Info("Notifier blocked, cant send notification")
+	}
+}
+
+func (sm *SecretManagerVault) closeNotifier() {
+	sm.notifierMu.Lock()
+	defer sm.notifierMu.Unlock()
+
+	if !sm.notifierClosed {
+		sm.notifierClosed = true
+		close(sm.notifier)
+	}
+}
@@ -0,0 +1,277 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestSetup - две папки под kv/main, на них держится большинство тестов записи и всего, что поверх нее
+var writeTestSetup = testManagerSetup{
+	mounts: map[string]int{"kv": KVVersion2},
+	secrets: map[string]map[string]any{
+		"kv/main/db":    {"db_user": "app", "db_password": "old"},
+		"kv/main/kafka": {"brokers": "b1:9092"},
+	},
+	options: []Option{WithMount("kv", "main")},
+}
+
+func TestPutSecret(t *testing.T) {
+	for _, test := range kvVersionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv, sm := newTestManager(t, writeTestSetup.withKVVersion(test.version))
+
+			version, err := sm.PutSecret(context.Background(), "db", map[string]any{"db_password": "new", "db_port": 5432})
+			require.NoError(t, err)
+			if test.version == KVVersion2 {
+				assert.Equal(t, 2, version)
+			} else {
+				assert.Equal(t, 0, version)
+			}
+
+			assert.Equal(t, map[string]any{"db_password": "new", "db_port": json.Number("5432")}, fv.secretData("kv/main/db"))
+
+			// без UpdateLocalConfig конфиг не трогаем
+			assert.Equal(t, "old", sm.config["db_password"])
+		})
+	}
+}
+
+func TestPutSecretUpdatesLocalConfig(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	_, err := sm.PutSecret(context.Background(), "db",
+		map[string]any{"db_password": "new", "db_port": 5432}, UpdateLocalConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, config{"db_password": "new", "db_port": json.Number("5432"), "brokers": "b1:9092"}, sm.config)
+
+	select {
+	case <-sm.GetNotifierChannel():
+	default:
+		t.Fatal("expected change notification after local update")
+	}
+
+	// после записи апдейтер должен видеть то же самое, что уже лежит в конфиге
+	fresh, err := sm.getFullConfigFromVault()
+	require.NoError(t, err)
+	assert.False(t, areConfigsDifferent(fresh, sm.getConfigCopy()))
+}
+
+func TestPatchSecret(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+
+	version, err := sm.PatchSecret(context.Background(), "db",
+		map[string]any{"db_password": "patched", "db_user": nil, "db_host": "localhost"}, UpdateLocalConfig())
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	assert.Equal(t, map[string]any{"db_password": "patched", "db_host": "localhost"}, fv.secretData("kv/main/db"))
+	assert.Equal(t, config{"db_password": "patched", "db_host": "localhost", "brokers": "b1:9092"}, sm.config)
+
+	_, err = sm.PatchSecret(context.Background(), "missing", map[string]any{"key": "value"})
+	assert.Error(t, err)
+}
+
+func TestPatchSecretNested(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	fv.putSecret("kv/main/pool", map[string]any{"pool": map[string]any{"size": 10, "timeout": "5s", "tls": map[string]any{"enabled": true}}})
+	require.NoError(t, sm.ReloadConfig())
+
+	_, err := sm.PatchSecret(context.Background(), "pool",
+		map[string]any{"pool": map[string]any{"size": 20, "timeout": nil, "tls": map[string]any{"ca": "ca.pem"}}}, UpdateLocalConfig())
+	require.NoError(t, err)
+
+	// вложенный объект сливается, а не заменяется целиком, и локальный конфиг совпадает с vault'ом
+	want := map[string]any{"size": json.Number("20"), "tls": map[string]any{"enabled": true, "ca": "ca.pem"}}
+	assert.Equal(t, map[string]any{"pool": want}, fv.secretData("kv/main/pool"))
+	assert.Equal(t, want, sm.config["pool"])
+
+	fresh, err := sm.getFullConfigFromVault()
+	require.NoError(t, err)
+	assert.False(t, areConfigsDifferent(fresh, sm.getConfigCopy()))
+}
+
+var localWriteWithVaultPathsTests = []struct {
+	name     string
+	write    func(sm *SecretManagerVault) error
+	expected config
+	notified bool
+}{
+	{
+		name: "delete falls back to other paths",
+		write: func(sm *SecretManagerVault) error {
+			return sm.DeleteSecret(context.Background(), "db", UpdateLocalConfig())
+		},
+		expected: config{"db_host": "db.team", "db_port": json.Number("5432"), "log_level": "info", "team": "payments"},
+		notified: true,
+	},
+	{
+		name: "write shadowed by another folder",
+		write: func(sm *SecretManagerVault) error {
+			_, err := sm.PutSecret(context.Background(), "kafka", map[string]any{"db_host": "db.kafka"}, UpdateLocalConfig())
+			return err
+		},
+		expected: config{
+			"db_host":     "db.payments",
+			"db_password": "secret",
+			"db_port":     json.Number("5432"),
+			"log_level":   "info",
+			"team":        "payments",
+		},
+	},
+}
+
+func TestLocalWriteWithVaultPaths(t *testing.T) {
+	for _, test := range localWriteWithVaultPathsTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, sm := newTestManager(t, multiPathTestSetup)
+
+			require.NoError(t, test.write(sm))
+			assert.Equal(t, test.expected, sm.config)
+
+			// локальный конфиг - тот же, что соберет апдейтер
+			fresh, err := sm.getFullConfigFromVault()
+			require.NoError(t, err)
+			assert.False(t, areConfigsDifferent(fresh, sm.getConfigCopy()))
+
+			select {
+			case <-sm.GetNotifierChannel():
+				assert.True(t, test.notified, "unexpected notification")
+			default:
+				assert.False(t, test.notified, "expected change notification")
+			}
+		})
+	}
+}
+
+func TestPatchSecretKVv1(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup.withKVVersion(KVVersion1))
+
+	_, err := sm.PatchSecret(context.Background(), "db", map[string]any{"db_password": "patched"})
+	assert.True(t, errors.Is(err, ErrPatchNotSupported))
+}
+
+func TestDeleteSecret(t *testing.T) {
+	for _, test := range kvVersionsTests {
+		t.Run(test.name, func(t *testing.T) {
+			fv, sm := newTestManager(t, writeTestSetup.withKVVersion(test.version))
+
+			require.NoError(t, sm.DeleteSecret(context.Background(), "db", UpdateLocalConfig()))
+
+			assert.Nil(t, fv.secretData("kv/main/db"))
+			assert.Equal(t, config{"brokers": "b1:9092"}, sm.config)
+		})
+	}
+}
+
+func TestOneNotificationPerWrite(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	go sm.StartConfigUpdater(10 * time.Millisecond)
+	t.Cleanup(func() { _ = sm.StopUpdater() })
+
+	require.Eventually(t, func() bool {
+		sm.RLock()
+		defer sm.RUnlock()
+		return sm.updaterBaseline != nil
+	}, time.Second, time.Millisecond)
+
+	_, err := sm.PatchSecret(context.Background(), "db", map[string]any{"db_password": "patched", "db_user": nil}, UpdateLocalConfig())
+	require.NoError(t, err)
+
+	notifications := 0
+	timeout := time.After(150 * time.Millisecond) // больше десяти обновлений апдейтера
+	for done := false; !done; {
+		select {
+		case <-sm.GetNotifierChannel():
+			notifications++
+		case <-timeout:
+			done = true
+		}
+	}
+	assert.Equal(t, 1, notifications)
+}
+
+func TestNotifyAfterUpdaterStopped(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup)
+
+	done := make(chan struct{})
+	go func() {
+		sm.StartConfigUpdater(DefaultConfigUpdateInterval)
+		close(done)
+	}()
+	require.NoError(t, sm.StopUpdater())
+	<-done
+
+	// канал уже закрыт апдейтером, запись не должна паниковать
+	_, err := sm.PutSecret(context.Background(), "kafka", map[string]any{"brokers": "b2:9092"}, UpdateLocalConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "b2:9092", sm.config["brokers"])
+}
+
+func TestReadModifyWriteWithCAS(t *testing.T) {
+	fv, sm := newTestManager(t, writeTestSetup)
+	ctx := context.Background()
+
+	data, version, err := sm.ReadSecret(ctx, "db")
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	_, secretVersion, err := sm.UpdateSpecificSecretWithVersion("db", "db_password")
+	require.NoError(t, err)
+	assert.Equal(t, version, secretVersion)
+
+	// кто-то другой успел поменять папку
+	fv.putSecret("kv/main/db", map[string]any{"db_user": "app", "db_password": "rotated"})
+
+	data["db_password"] = "mine"
+	_, err = sm.PutSecret(ctx, "db", data, WithCAS(version))
+	require.True(t, errors.Is(err, ErrCASConflict))
+
+	var conflict *CASConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "db", conflict.Folder)
+	assert.Equal(t, 1, conflict.ExpectedVersion)
+	assert.Equal(t, 2, conflict.CurrentVersion)
+	assert.Equal(t, []KeyChange{{Key: "db_password", Kind: ChangeModified, Old: "old", New: "rotated"}}, conflict.Diff)
+	assert.Equal(t, "rotated", fv.secretData("kv/main/db")["db_password"])
+
+	// повторяем цикл с актуальной версией
+	currentVersion, ok := sm.SecretVersion("db")
+	require.True(t, ok)
+	assert.Equal(t, 2, currentVersion)
+
+	newVersion, err := sm.PutSecret(ctx, "db", data, WithCAS(currentVersion))
+	require.NoError(t, err)
+	assert.Equal(t, 3, newVersion)
+	assert.Equal(t, "mine", fv.secretData("kv/main/db")["db_password"])
+
+	_, err = sm.PatchSecret(ctx, "db", map[string]any{"db_password": "patched"}, WithCAS(2))
+	assert.True(t, errors.Is(err, ErrCASConflict))
+
+	_, err = sm.PatchSecret(ctx, "db", map[string]any{"db_password": "patched"}, WithCAS(3))
+	assert.NoError(t, err)
+
+	// cas=0 - только создание новой папки
+	_, err = sm.PutSecret(ctx, "fresh", map[string]any{"key": "value"}, WithCAS(0))
+	assert.NoError(t, err)
+	_, err = sm.PutSecret(ctx, "fresh", map[string]any{"key": "value"}, WithCAS(0))
+	assert.True(t, errors.Is(err, ErrCASConflict))
+}
+
+func TestCASNotSupported(t *testing.T) {
+	_, sm := newTestManager(t, writeTestSetup.withKVVersion(KVVersion1))
+
+	_, err := sm.PutSecret(context.Background(), "db", map[string]any{"db_password": "new"}, WithCAS(1))
+	assert.True(t, errors.Is(err, ErrCASNotSupported))
+
+	_, sm = newTestManager(t, writeTestSetup)
+	err = sm.DeleteSecret(context.Background(), "db", WithCAS(1))
+	assert.True(t, errors.Is(err, ErrCASNotSupported))
+}